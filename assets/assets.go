@@ -0,0 +1,95 @@
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The file system of the public assets, set by main.
+var FS fs.FS
+
+// The URL path prefix that assets are served under.
+const URLPrefix = "/assets/"
+
+// The number of hex digits of a file's hash in its fingerprinted name.
+const HashLength = 8
+
+// Matches the hash in a fingerprinted asset name, such as ".1a2b3c4d" in
+// "style.1a2b3c4d.css", capturing the hash and the extension.
+var fingerprintRegex = regexp.MustCompile(`\.([0-9a-f]{` + strconv.Itoa(HashLength) + `})(\.[^./]+)$`)
+
+var (
+	mutex  sync.Mutex
+	hashes = map[string]string{}
+)
+
+// Returns the fingerprinted URL of an asset, such as "/assets/style.1a2b3c4d.css"
+// for "style.css". The name changes whenever the content of the file changes,
+// so the URL can be cached forever. Falls back to the plain URL of the asset if
+// it cannot be read.
+func URL(name string) string {
+	hash, err := getHash(name)
+	if err != nil {
+		slog.Error("assets: failed to hash asset", slog.String("name", name), slog.String("cause", err.Error()))
+		return URLPrefix + name
+	}
+
+	ext := path.Ext(name)
+	return URLPrefix + strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// Resolves a fingerprinted asset name into the name of its file. Returns false
+// if the name is not fingerprinted, and whether the fingerprint matches the
+// current content of the file.
+func Resolve(fingerprinted string) (name string, isCurrent bool, ok bool) {
+	match := fingerprintRegex.FindStringSubmatch(fingerprinted)
+	if FS == nil || match == nil {
+		return "", false, false
+	}
+
+	// files that happen to look fingerprinted are served as they are
+	if _, err := fs.Stat(FS, fingerprinted); err == nil {
+		return "", false, false
+	}
+
+	name = strings.TrimSuffix(fingerprinted, match[0]) + match[2]
+	hash, err := getHash(name)
+	if err != nil {
+		return "", false, false
+	}
+	return name, hash == match[1], true
+}
+
+func getHash(name string) (string, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if hash, isCached := hashes[name]; isCached {
+		return hash, nil
+	}
+
+	data, err := fs.ReadFile(FS, name)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:HashLength]
+	hashes[name] = hash
+	return hash, nil
+}
+
+// Clears the cached hash of an asset, so that it is recomputed when the asset's
+// URL is next requested.
+func ClearCache(name string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	delete(hashes, name)
+}
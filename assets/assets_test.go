@@ -0,0 +1,50 @@
+package assets
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprints(t *testing.T) {
+	fsys := fstest.MapFS{
+		"style.css":          {Data: []byte("body {}")},
+		"lib.0123abcd.js":    {Data: []byte("")},
+		"img/photo.jpg":      {Data: []byte("jpg")},
+		"no-extension-asset": {Data: []byte("")},
+	}
+	FS = fsys
+	defer func() {
+		FS = nil
+		clear(hashes)
+	}()
+
+	url := URL("style.css")
+	assert.Regexp(t, `^/assets/style\.[0-9a-f]{8}\.css$`, url)
+	assert.Regexp(t, `^/assets/img/photo\.[0-9a-f]{8}\.jpg$`, URL("img/photo.jpg"))
+	assert.Equal(t, "/assets/missing.css", URL("missing.css"), "should fall back to the plain URL")
+
+	name, isCurrent, ok := Resolve(url[len(URLPrefix):])
+	assert.True(t, ok)
+	assert.True(t, isCurrent)
+	assert.Equal(t, "style.css", name)
+
+	_, _, ok = Resolve("style.css")
+	assert.False(t, ok, "should not resolve plain names")
+	_, _, ok = Resolve("lib.0123abcd.js")
+	assert.False(t, ok, "should not resolve files that look fingerprinted")
+	_, _, ok = Resolve("missing.0123abcd.css")
+	assert.False(t, ok, "should not resolve missing files")
+
+	fsys["style.css"] = &fstest.MapFile{Data: []byte("body { color: red }")}
+	assert.Equal(t, url, URL("style.css"), "should cache hashes")
+
+	ClearCache("style.css")
+	assert.NotEqual(t, url, URL("style.css"), "should rehash changed files")
+
+	name, isCurrent, ok = Resolve(url[len(URLPrefix):])
+	assert.True(t, ok, "should resolve outdated fingerprints")
+	assert.False(t, isCurrent)
+	assert.Equal(t, "style.css", name)
+}
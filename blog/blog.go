@@ -2,47 +2,158 @@ package blog
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"io/fs"
+	"fmt"
+	"html"
+	"html/template"
 	"log"
 	"log/slog"
-	"os"
 	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/mecha/mecha.dev/site"
 )
 
 var db *sql.DB
 
+// The version of the database's format. Persistent databases with a different
+// version are rebuilt from scratch, so this must be bumped whenever the schema
+// or the meaning of the stored columns changes. Changes to how posts are
+// rendered are tracked by RenderKey instead.
+const schemaVersion = 8
+
+// Initializes an in-memory database.
 func InitDB() error {
+	return InitDBFile(":memory:")
+}
+
+// Initializes a database that is persisted to a file. Its posts are kept
+// between runs, so that LoadFromFs only needs to reindex changed files.
+func InitDBFile(path string) error {
 	if db != nil {
 		return errors.New("blog is already initialized")
 	}
 
-	slog.Info("blog: initializing in-memory sqlite database")
-	conn, err := sql.Open("sqlite3", ":memory:")
+	dsn := path
+	if path == ":memory:" {
+		slog.Info("blog: initializing in-memory sqlite database")
+	} else {
+		slog.Info("blog: initializing sqlite database", "path", path)
+		dsn = "file:" + path + "?_journal_mode=WAL&_busy_timeout=5000"
+	}
+
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return err
 	}
 
+	// every connection to an in-memory database gets its own empty database,
+	// so all queries must share a single connection
+	if path == ":memory:" {
+		conn.SetMaxOpenConns(1)
+	}
+
 	db = conn
 
+	err = migrateDB()
+	if err != nil {
+		DestroyDB()
+		return err
+	}
+
+	return nil
+}
+
+// Rebuilds the database schema if it was created by a different version.
+func migrateDB() error {
+	version := 0
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	if version == schemaVersion {
+		return nil
+	}
+
+	if version != 0 {
+		slog.Info("blog: rebuilding outdated database", slog.Int("version", version))
+		for _, table := range []string{"posts", "post_tags", "posts_fts", "post_files"} {
+			_, err = db.Exec("DROP TABLE IF EXISTS " + table)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = createSchema()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion))
+	return err
+}
+
+func createSchema() error {
 	slog.Info("blog: creating posts table")
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS posts (
-		slug TEXT PRIMARY KEY,
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS posts (
+		id INTEGER PRIMARY KEY,
+		slug TEXT UNIQUE NOT NULL,
 		title TEXT,
 		excerpt TEXT,
 		body TEXT,
+		text TEXT,
 		date TEXT,
-		public INTEGER
+		public INTEGER,
+		author TEXT,
+		publish_at TEXT,
+		expires_at TEXT,
+		series TEXT,
+		series_order INTEGER,
+		outline TEXT,
+		show_toc INTEGER,
+		word_count INTEGER,
+		reading_time INTEGER,
+		updated TEXT
 	)`)
 	if err != nil {
 		return err
 	}
 
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS posts_series ON posts (series)`)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("blog: creating post tags table")
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS post_tags (
+		slug TEXT,
+		tag TEXT,
+		PRIMARY KEY (slug, tag)
+	)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS post_tags_tag ON post_tags (tag)`)
+	if err != nil {
+		return err
+	}
+
+	// the fts table indexes the posts table's contents without storing a copy,
+	// so the triggers below must keep it in sync with every change to posts
 	slog.Info("blog: creating fts virual table")
-	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(slug, title, body, tokenize = 'trigram')`)
+	_, err = db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+		title,
+		excerpt,
+		text,
+		content = 'posts',
+		content_rowid = 'id',
+		tokenize = 'trigram'
+	)`)
 	if err != nil {
 		return err
 	}
@@ -50,16 +161,48 @@ func InitDB() error {
 	slog.Info("blog: creating fts insert trigger")
 	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts
 	BEGIN
-		INSERT INTO posts_fts (slug, title, body) VALUES (NEW.slug, NEW.title, NEW.body);
+		INSERT INTO posts_fts (rowid, title, excerpt, text) VALUES (NEW.id, NEW.title, NEW.excerpt, NEW.text);
+	END`)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("blog: creating fts update trigger")
+	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE ON posts
+	BEGIN
+		INSERT INTO posts_fts (posts_fts, rowid, title, excerpt, text) VALUES ('delete', OLD.id, OLD.title, OLD.excerpt, OLD.text);
+		INSERT INTO posts_fts (rowid, title, excerpt, text) VALUES (NEW.id, NEW.title, NEW.excerpt, NEW.text);
 	END`)
 	if err != nil {
 		return err
 	}
 
 	slog.Info("blog: creating fts delete trigger")
-	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER DELETE ON posts
+	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts
 	BEGIN
-		DELETE FROM posts_fts WHERE slug = OLD.slug;
+		INSERT INTO posts_fts (posts_fts, rowid, title, excerpt, text) VALUES ('delete', OLD.id, OLD.title, OLD.excerpt, OLD.text);
+	END`)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("blog: creating post files table")
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS post_files (
+		path TEXT PRIMARY KEY,
+		slug TEXT,
+		hash TEXT,
+		mtime TEXT,
+		size INTEGER,
+		render_key TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("blog: creating tags delete trigger")
+	_, err = db.Exec(`CREATE TRIGGER IF NOT EXISTS post_tags_delete AFTER DELETE ON posts
+	BEGIN
+		DELETE FROM post_tags WHERE slug = OLD.slug;
 	END`)
 	if err != nil {
 		return err
@@ -81,47 +224,57 @@ func DestroyDB() {
 	db = nil
 }
 
-func LoadFromFs(fsys fs.FS) (int, error) {
-	entries, err := fs.ReadDir(fsys, ".")
-
-	if os.IsNotExist(err) {
-		entries = []os.DirEntry{}
-	} else if err != nil {
-		return 0, err
-	}
-
-	num := 0
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		name := entry.Name()
-		if !strings.HasSuffix(name, ".md") {
-			continue
-		}
-
-		post, err := ParsePostFile(fsys, name)
-		if err != nil {
-			return num, err
-		}
-
-		err = InsertPost(post)
-		if err != nil {
-			return num, err
-		}
-
-		num++
-	}
+// The columns selected for posts, in the order expected by rowToPost.
+const postColumns = `posts.slug, posts.title, posts.excerpt, posts.body, posts.date, posts.public, posts.author,
+	posts.publish_at, posts.expires_at, posts.series, posts.series_order, posts.outline, posts.show_toc,
+	posts.word_count, posts.reading_time, posts.updated,
+	(SELECT group_concat(tag, ',') FROM post_tags WHERE post_tags.slug = posts.slug)`
+
+// The condition for a post to be listed: it must be public, its publish time
+// (or its date if it has none) must have passed and it must not have expired.
+// The current time is evaluated by each query, so scheduled posts appear and
+// expired posts disappear without reloading.
+const visibleCondition = `posts.public = true
+	AND julianday(coalesce(posts.publish_at, posts.date)) <= julianday('now')
+	AND (posts.expires_at IS NULL OR julianday(posts.expires_at) > julianday('now'))`
+
+// Selects a fragment of the best matching column for a search, with the
+// matching terms wrapped in sentinel characters that are replaced by
+// snippetToHTML, since the text itself must be HTML-escaped.
+const searchSnippet = `snippet(posts_fts, -1, char(2), char(3), '…', 64)`
+
+// The weights of the posts_fts columns when ranking search results: title,
+// excerpt and text respectively.
+const searchRank = `bm25(posts_fts, 10.0, 5.0, 1.0)`
+
+// Criteria for narrowing down lists of posts.
+type Filter struct {
+	// Full-text search term. Ignored if shorter than 3 characters.
+	Search string
+	// Only include posts that have this tag.
+	Tag string
+	// Only include posts written by this author, where posts without an author
+	// are written by the site's author. Case insensitive.
+	Author string
+}
 
-	slog.Info("blog: loaded blog posts from filesystem", slog.Int("num", num))
+// A post that matched a search.
+type SearchResult struct {
+	*Post
+	// A fragment of the post's text, with the search terms wrapped in <mark>
+	// tags. Empty if the search had no search term.
+	Snippet template.HTML
+}
 
-	return num, nil
+// The number of posts that use a tag.
+type TagCount struct {
+	Tag   string
+	Count int
 }
 
 func GetPostBySlug(slug string) (*Post, error) {
 	stmt, err := db.Prepare(`
-		SELECT slug, title, excerpt, body, date, public
+		SELECT ` + postColumns + `
 		FROM posts
 		WHERE slug = ?
 		LIMIT 1
@@ -134,30 +287,119 @@ func GetPostBySlug(slug string) (*Post, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	found := rows.Next()
 	if !found {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
 		return nil, sql.ErrNoRows
 	}
 
-	post, err := rowToPost(rows)
-	rows.Next()
+	return rowToPost(rows)
+}
 
-	return post, err
+// Retrieves the visible posts in a series, in reading order.
+func GetSeriesPosts(series string) ([]*Post, error) {
+	rows, err := db.Query(`
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE `+visibleCondition+` AND posts.series = ?
+		ORDER BY posts.series_order, julianday(posts.date), posts.slug
+	`, series)
+	if err != nil {
+		return nil, err
+	}
+
+	return manyRowsToPosts(rows)
+}
+
+// Retrieves the visible posts that were published right before and right
+// after a post, by date. Either post is nil if there is none.
+func GetAdjacentPosts(post *Post) (*Post, *Post, error) {
+	date := post.Date.Format(time.RFC3339)
+
+	prev, err := getOnePost(`
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE `+visibleCondition+`
+			AND (julianday(posts.date) < julianday(?) OR (julianday(posts.date) = julianday(?) AND posts.slug < ?))
+		ORDER BY julianday(posts.date) DESC, posts.slug DESC
+		LIMIT 1
+	`, date, date, post.Slug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next, err := getOnePost(`
+		SELECT `+postColumns+`
+		FROM posts
+		WHERE `+visibleCondition+`
+			AND (julianday(posts.date) > julianday(?) OR (julianday(posts.date) = julianday(?) AND posts.slug > ?))
+		ORDER BY julianday(posts.date), posts.slug
+		LIMIT 1
+	`, date, date, post.Slug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return prev, next, nil
+}
+
+// Retrieves the first post found by a query, or nil if it finds none.
+func getOnePost(query string, args ...any) (*Post, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := manyRowsToPosts(rows)
+	if err != nil || len(posts) == 0 {
+		return nil, err
+	}
+	return posts[0], nil
 }
 
 func NumPublicPosts() (int, error) {
-	row := db.QueryRow("SELECT COUNT(slug) FROM posts WHERE public = true")
+	row := db.QueryRow("SELECT COUNT(slug) FROM posts WHERE " + visibleCondition)
 	count := 0
 	err := row.Scan(&count)
 	return count, err
 }
 
+// Retrieves all tags used by visible posts, along with the number of posts that
+// use each tag, in alphabetical order.
+func GetTags() ([]*TagCount, error) {
+	rows, err := db.Query(`
+		SELECT tag, COUNT(posts.slug)
+		FROM post_tags
+		JOIN posts ON posts.slug = post_tags.slug
+		WHERE ` + visibleCondition + `
+		GROUP BY tag
+		ORDER BY tag
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := make([]*TagCount, 0)
+	for rows.Next() {
+		tag := &TagCount{}
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
 func GetPosts(limit, offset int) ([]*Post, error) {
 	stmt, err := db.Prepare(`
-		SELECT slug, title, excerpt, body, date, public
+		SELECT ` + postColumns + `
 		FROM posts
-		WHERE public = true
+		WHERE ` + visibleCondition + `
 		ORDER BY date(date) DESC
 		LIMIT ? OFFSET ?
 	`)
@@ -173,43 +415,178 @@ func GetPosts(limit, offset int) ([]*Post, error) {
 	return manyRowsToPosts(rows)
 }
 
-func SearchPosts(term string, limit, offset int) ([]*Post, error) {
-	term = strings.TrimSpace(term)
-	if len(term) < 3 {
-		return GetPosts(limit, offset)
+func SearchPosts(filter Filter, limit, offset int) ([]*SearchResult, error) {
+	if filter.isEmpty() {
+		posts, err := GetPosts(limit, offset)
+		return postsToSearchResults(posts), err
+	}
+
+	query := filter.toQuery()
+
+	columns, orderBy := postColumns+", ''", "date(posts.date) DESC"
+	if query.isFullText {
+		columns = postColumns + ", " + searchSnippet
+		orderBy = searchRank + ", " + orderBy
 	}
 
 	stmt, err := db.Prepare(`
-		SELECT slug, title, excerpt, body, date, public
-		FROM posts
-		WHERE public = true AND slug IN (
-			SELECT slug
-			FROM posts_fts
-			WHERE posts_fts MATCH ?
-			ORDER BY rank
-		)
+		SELECT ` + columns + `
+		FROM ` + query.from + `
+		WHERE ` + query.where + `
+		ORDER BY ` + orderBy + `, posts.id
 		LIMIT ? OFFSET ?
 	`)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := stmt.Query(term, limit, offset)
+	rows, err := stmt.Query(append(query.args, limit, offset)...)
 	if err != nil {
 		return nil, err
 	}
 
-	return manyRowsToPosts(rows)
+	defer rows.Close()
+
+	results := make([]*SearchResult, 0)
+	for rows.Next() {
+		snippet := ""
+		post, err := rowToPost(rows, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &SearchResult{post, snippetToHTML(snippet)})
+	}
+	return results, rows.Err()
+}
+
+// Counts the total number of posts that SearchPosts would find for a filter,
+// across all pages.
+func CountSearchResults(filter Filter) (int, error) {
+	if filter.isEmpty() {
+		return NumPublicPosts()
+	}
+
+	query := filter.toQuery()
+	row := db.QueryRow(`SELECT COUNT(posts.id) FROM `+query.from+` WHERE `+query.where, query.args...)
+
+	count := 0
+	err := row.Scan(&count)
+	return count, err
+}
+
+// The FROM and WHERE clauses of a query for posts that match a filter.
+type filterQuery struct {
+	from       string
+	where      string
+	args       []any
+	isFullText bool
+}
+
+// Whether the filter lets through all visible posts.
+func (filter Filter) isEmpty() bool {
+	return len(strings.TrimSpace(filter.Search)) < 3 &&
+		NormalizeTag(filter.Tag) == "" &&
+		strings.TrimSpace(filter.Author) == ""
+}
+
+func (filter Filter) toQuery() filterQuery {
+	query := filterQuery{from: "posts"}
+	where := []string{visibleCondition}
+
+	if match := ftsQuery(strings.TrimSpace(filter.Search)); match != "" {
+		query.from = "posts JOIN posts_fts ON posts_fts.rowid = posts.id"
+		query.isFullText = true
+		where = append(where, "posts_fts MATCH ?")
+		query.args = append(query.args, match)
+	}
+	if tag := NormalizeTag(filter.Tag); tag != "" {
+		where = append(where, "posts.slug IN (SELECT slug FROM post_tags WHERE tag = ?)")
+		query.args = append(query.args, tag)
+	}
+	if author := strings.TrimSpace(filter.Author); author != "" {
+		// posts without an author are written by the site's author
+		where = append(where, "coalesce(nullif(posts.author, ''), ?) = ? COLLATE NOCASE")
+		query.args = append(query.args, site.Current.Author().Name, author)
+	}
+
+	query.where = strings.Join(where, " AND ")
+	return query
+}
+
+// Converts a search term into an fts5 query that matches posts containing
+// every word in the term. Words are quoted so that they are matched literally,
+// and words shorter than 3 characters are dropped since the trigram tokenizer
+// cannot match them.
+func ftsQuery(search string) string {
+	words := []string{}
+	for _, word := range strings.Fields(search) {
+		if len([]rune(word)) >= 3 {
+			words = append(words, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+		}
+	}
+	return strings.Join(words, " ")
 }
 
 func InsertPost(post *Post) error {
-	stmt, err := db.Prepare(`
-		REPLACE INTO posts (slug, title, excerpt, body, date, public) VALUES
-		(?, ?, ?, ?, ?, ?)
-	`)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(post.Slug, post.Title, post.Excerpt, post.Body, post.Date.Format(time.RFC3339), post.Public)
-	return err
+	outlineJSON, err := json.Marshal(post.Outline)
+	if err != nil {
+		return err
+	}
+
+	// upsert rather than replace, so that the update trigger keeps the fts index in sync
+	_, err = tx.Exec(`
+		INSERT INTO posts (
+			slug, title, excerpt, body, text, date, public, author,
+			publish_at, expires_at, series, series_order, outline, show_toc, word_count, reading_time,
+			updated
+		) VALUES
+		(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (slug) DO UPDATE SET
+			title = excluded.title,
+			excerpt = excluded.excerpt,
+			body = excluded.body,
+			text = excluded.text,
+			date = excluded.date,
+			public = excluded.public,
+			author = excluded.author,
+			publish_at = excluded.publish_at,
+			expires_at = excluded.expires_at,
+			series = excluded.series,
+			series_order = excluded.series_order,
+			outline = excluded.outline,
+			show_toc = excluded.show_toc,
+			word_count = excluded.word_count,
+			reading_time = excluded.reading_time,
+			updated = excluded.updated
+	`,
+		post.Slug, post.Title, post.Excerpt, post.Body, plainText(post.Body), post.Date.Format(time.RFC3339), post.Public, post.Author,
+		timeToNullString(post.PublishAt), timeToNullString(post.ExpiresAt), post.Series, post.SeriesOrder,
+		outlineJSON, post.ShowTOC, post.WordCount, post.ReadingTime,
+		timeToNullString(post.Updated),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM post_tags WHERE slug = ?", post.Slug)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range post.Tags {
+		_, err = tx.Exec("INSERT OR IGNORE INTO post_tags (slug, tag) VALUES (?, ?)", post.Slug, tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func DeletePost(slug string) (bool, error) {
@@ -236,7 +613,26 @@ func DeleteAllPosts() error {
 	return nil
 }
 
+// Converts a snippet with sentinel characters into HTML with <mark> tags.
+func snippetToHTML(snippet string) template.HTML {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, "\x02", "<mark>")
+	snippet = strings.ReplaceAll(snippet, "\x03", "</mark>")
+	return template.HTML(snippet)
+}
+
+func postsToSearchResults(posts []*Post) []*SearchResult {
+	results := make([]*SearchResult, len(posts))
+	for i, post := range posts {
+		results[i] = &SearchResult{Post: post}
+	}
+	return results
+}
+
+// Scans all rows into posts, and closes the rows.
 func manyRowsToPosts(rows *sql.Rows) ([]*Post, error) {
+	defer rows.Close()
+
 	posts := make([]*Post, 0)
 	for rows.Next() {
 		post, err := rowToPost(rows)
@@ -245,19 +641,29 @@ func manyRowsToPosts(rows *sql.Rows) ([]*Post, error) {
 		}
 		posts = append(posts, post)
 	}
-	return posts, nil
+	return posts, rows.Err()
 }
 
-func rowToPost(rows *sql.Rows) (*Post, error) {
+// Scans a row of postColumns into a post. Any extra columns that follow are
+// scanned into the given destinations.
+func rowToPost(rows *sql.Rows, extra ...any) (*Post, error) {
 	post := &Post{}
-	dateStr, pubStr := "", 0
-
-	err := rows.Scan(&post.Slug, &post.Title, &post.Excerpt, &post.Body, &dateStr, &pubStr)
+	dateStr, pubStr, tagsStr := "", 0, sql.NullString{}
+	publishAtStr, expiresAtStr := sql.NullString{}, sql.NullString{}
+	outlineStr, updatedStr := sql.NullString{}, sql.NullString{}
+
+	dest := []any{
+		&post.Slug, &post.Title, &post.Excerpt, &post.Body, &dateStr, &pubStr, &post.Author,
+		&publishAtStr, &expiresAtStr, &post.Series, &post.SeriesOrder, &outlineStr, &post.ShowTOC,
+		&post.WordCount, &post.ReadingTime, &updatedStr, &tagsStr,
+	}
+	err := rows.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
 
 	post.Public = pubStr != 0
+	post.Tags = ParseTags(tagsStr.String)
 
 	date, err := time.Parse(time.RFC3339, dateStr)
 	if err != nil {
@@ -265,5 +671,37 @@ func rowToPost(rows *sql.Rows) (*Post, error) {
 	}
 	post.Date = date
 
+	if post.PublishAt, err = nullStringToTime(publishAtStr); err != nil {
+		return post, err
+	}
+	if post.ExpiresAt, err = nullStringToTime(expiresAtStr); err != nil {
+		return post, err
+	}
+
+	if post.Updated, err = nullStringToTime(updatedStr); err != nil {
+		return post, err
+	}
+
+	if outlineStr.Valid {
+		if err := json.Unmarshal([]byte(outlineStr.String), &post.Outline); err != nil {
+			return post, err
+		}
+	}
+
 	return post, nil
 }
+
+// Formats an optional time for storage, where the zero time is stored as NULL.
+func timeToNullString(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(time.RFC3339), Valid: true}
+}
+
+func nullStringToTime(str sql.NullString) (time.Time, error) {
+	if !str.Valid {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, str.String)
+}
@@ -1,10 +1,12 @@
 package blog
 
 import (
+	"html/template"
 	"log/slog"
 	"testing"
 	"time"
 
+	"github.com/mecha/mecha.dev/site"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -152,15 +154,259 @@ func TestSearchPosts(t *testing.T) {
 		assert.Nil(t, err, "should insert post without error")
 	}
 
-	posts, err := SearchPosts("cats", 5, 0)
+	results, err := SearchPosts(Filter{Search: "cats"}, 5, 0)
 	assert.Nil(t, err, "should search posts without error")
-	assert.Equal(t, []*Post{p1, p2}, posts)
+	assert.Equal(t, []*Post{p1, p2}, searchResultPosts(results))
 
-	posts, err = SearchPosts("dog", 5, 0)
+	results, err = SearchPosts(Filter{Search: "dog"}, 5, 0)
 	assert.Nil(t, err, "should search posts without error")
-	assert.Equal(t, []*Post{p1, p2, p5}, posts)
+	assert.Equal(t, []*Post{p1, p2, p5}, searchResultPosts(results))
 
-	posts, err = SearchPosts("dog", 2, 2)
+	results, err = SearchPosts(Filter{Search: "dog"}, 2, 2)
 	assert.Nil(t, err, "should search posts without error")
-	assert.Equal(t, []*Post{p5}, posts)
+	assert.Equal(t, []*Post{p5}, searchResultPosts(results))
+
+	num, err := CountSearchResults(Filter{Search: "dog"})
+	assert.Nil(t, err, "should count search results without error")
+	assert.Equal(t, 3, num)
+
+	num, err = CountSearchResults(Filter{Search: "kitty"})
+	assert.Nil(t, err, "should count search results without error")
+	assert.Equal(t, 1, num)
+
+	num, err = CountSearchResults(Filter{})
+	assert.Nil(t, err, "should count all posts without error")
+	assert.Equal(t, 4, num)
+}
+
+func TestPostTags(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	p1 := &Post{Slug: "post1", Public: true, Body: "cats and dogs", Tags: []string{"cats", "dogs"}}
+	p2 := &Post{Slug: "post2", Public: true, Body: "just dogs", Tags: []string{"dogs"}}
+	p3 := &Post{Slug: "post3", Public: false, Body: "secret cats", Tags: []string{"cats"}}
+	p4 := &Post{Slug: "post4", Public: true, Body: "no tags here"}
+
+	for _, post := range []*Post{p1, p2, p3, p4} {
+		err = InsertPost(post)
+		assert.Nil(t, err, "should insert post without error")
+	}
+
+	post, err := GetPostBySlug("post1")
+	assert.Nil(t, err, "should get post without error")
+	assert.Equal(t, []string{"cats", "dogs"}, post.Tags)
+
+	results, err := SearchPosts(Filter{Tag: "dogs"}, 5, 0)
+	assert.Nil(t, err, "should filter posts by tag without error")
+	assert.Equal(t, []*Post{p1, p2}, searchResultPosts(results))
+
+	results, err = SearchPosts(Filter{Tag: "cats", Search: "dogs"}, 5, 0)
+	assert.Nil(t, err, "should filter and search posts without error")
+	assert.Equal(t, []*Post{p1}, searchResultPosts(results))
+
+	num, err := CountSearchResults(Filter{Tag: "cats"})
+	assert.Nil(t, err, "should count tagged posts without error")
+	assert.Equal(t, 1, num)
+
+	tags, err := GetTags()
+	assert.Nil(t, err, "should get tags without error")
+	assert.Equal(t, []*TagCount{{"cats", 1}, {"dogs", 2}}, tags)
+
+	p1.Tags = []string{"birds"}
+	err = InsertPost(p1)
+	assert.Nil(t, err, "should update post without error")
+
+	tags, err = GetTags()
+	assert.Nil(t, err, "should get tags without error")
+	assert.Equal(t, []*TagCount{{"birds", 1}, {"dogs", 1}}, tags)
+}
+
+func TestSearchPostsByDefaultAuthor(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	site.Current = &site.Config{Authors: []site.Author{{Name: "Miguel Muscat"}}}
+	defer func() { site.Current = site.Default() }()
+
+	p1 := &Post{Slug: "post1", Public: true}
+	p2 := &Post{Slug: "post2", Public: true, Author: "Alice"}
+	p3 := &Post{Slug: "post3", Public: true, Author: "miguel muscat"}
+	for _, post := range []*Post{p1, p2, p3} {
+		err = InsertPost(post)
+		assert.Nil(t, err, "should insert post without error")
+	}
+
+	results, err := SearchPosts(Filter{Author: "Miguel Muscat"}, 5, 0)
+	assert.Nil(t, err, "should filter posts by author without error")
+	assert.ElementsMatch(t, []*Post{p1, p3}, searchResultPosts(results), "posts without an author should be by the site's author")
+
+	results, err = SearchPosts(Filter{Author: "alice"}, 5, 0)
+	assert.Nil(t, err, "should filter posts by author without error")
+	assert.Equal(t, []*Post{p2}, searchResultPosts(results))
+}
+
+func TestSearchPostsAfterUpdate(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	post := &Post{Slug: "post1", Public: true, Body: "cats and dogs"}
+	err = InsertPost(post)
+	assert.Nil(t, err, "should insert post without error")
+
+	post.Body = "birds and fish"
+	err = InsertPost(post)
+	assert.Nil(t, err, "should update post without error")
+
+	results, err := SearchPosts(Filter{Search: "cats"}, 5, 0)
+	assert.Nil(t, err, "should search posts without error")
+	assert.Equal(t, []*Post{}, searchResultPosts(results), "should not match stale content")
+
+	results, err = SearchPosts(Filter{Search: "birds"}, 5, 0)
+	assert.Nil(t, err, "should search posts without error")
+	assert.Equal(t, []*Post{post}, searchResultPosts(results))
+
+	_, err = DeletePost("post1")
+	assert.Nil(t, err, "should delete post without error")
+
+	results, err = SearchPosts(Filter{Search: "birds"}, 5, 0)
+	assert.Nil(t, err, "should search posts without error")
+	assert.Equal(t, []*Post{}, searchResultPosts(results), "should not match deleted posts")
+}
+
+func TestSearchPostsRanking(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	p1 := &Post{Slug: "post1", Public: true, Title: "Cooking", Body: "a post about pasta and linkers"}
+	p2 := &Post{Slug: "post2", Public: true, Title: "Linkers", Body: "a post about linkers"}
+	p3 := &Post{Slug: "post3", Public: true, Title: "Misc", Excerpt: "linkers, briefly", Body: "a post about things"}
+
+	for _, post := range []*Post{p1, p2, p3} {
+		err = InsertPost(post)
+		assert.Nil(t, err, "should insert post without error")
+	}
+
+	results, err := SearchPosts(Filter{Search: "linkers"}, 5, 0)
+	assert.Nil(t, err, "should search posts without error")
+	assert.Equal(t, []*Post{p2, p3, p1}, searchResultPosts(results), "should rank title matches over excerpt and body matches")
+
+	results, err = SearchPosts(Filter{Search: `"linkers" OR *`}, 5, 0)
+	assert.Nil(t, err, "should not fail on fts syntax in search terms")
+	assert.Equal(t, []*Post{}, searchResultPosts(results))
+}
+
+func TestSearchPostsSnippets(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	post := &Post{Slug: "post1", Public: true, Body: "<p>cats &amp; <b>dogs</b></p>"}
+	err = InsertPost(post)
+	assert.Nil(t, err, "should insert post without error")
+
+	results, err := SearchPosts(Filter{Search: "dog"}, 5, 0)
+	assert.Nil(t, err, "should search posts without error")
+	assert.Len(t, results, 1)
+	assert.Equal(t, template.HTML("cats &amp; <mark>dog</mark>s"), results[0].Snippet)
+
+	results, err = SearchPosts(Filter{}, 5, 0)
+	assert.Nil(t, err, "should list posts without error")
+	assert.Len(t, results, 1)
+	assert.Equal(t, template.HTML(""), results[0].Snippet)
+}
+
+func searchResultPosts(results []*SearchResult) []*Post {
+	posts := make([]*Post, len(results))
+	for i, result := range results {
+		posts[i] = result.Post
+	}
+	return posts
+}
+
+func TestScheduledPosts(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	now := time.Now().UTC()
+	posts := []*Post{
+		{Slug: "past", Title: "Golang past", Date: now.Add(-time.Hour), Public: true, Tags: []string{"go"}},
+		{Slug: "future", Title: "Golang future", Date: now.Add(time.Hour), Public: true, Tags: []string{"go"}},
+		{Slug: "scheduled", Title: "Golang scheduled", Date: now.Add(-time.Hour), PublishAt: now.Add(time.Hour), Public: true},
+		{Slug: "published", Title: "Golang published", Date: now.Add(time.Hour), PublishAt: now.Add(-time.Hour), Public: true},
+		{Slug: "expired", Title: "Golang expired", Date: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour), Public: true},
+		{Slug: "expiring", Title: "Golang expiring", Date: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Hour), Public: true},
+	}
+	for _, post := range posts {
+		assert.Nil(t, InsertPost(post), "should insert post without error")
+	}
+
+	listed, err := GetPosts(10, 0)
+	assert.Nil(t, err, "should get posts without error")
+	slugs := []string{}
+	for _, post := range listed {
+		slugs = append(slugs, post.Slug)
+	}
+	assert.ElementsMatch(t, []string{"past", "published", "expiring"}, slugs)
+
+	num, err := NumPublicPosts()
+	assert.Nil(t, err, "should count posts without error")
+	assert.Equal(t, 3, num)
+
+	results, err := SearchPosts(Filter{Search: "golang"}, 10, 0)
+	assert.Nil(t, err, "should search posts without error")
+	assert.Len(t, results, 3)
+
+	tags, err := GetTags()
+	assert.Nil(t, err, "should get tags without error")
+	assert.Equal(t, []*TagCount{{"go", 1}}, tags)
+
+	// scheduled posts are still stored with their schedule
+	post, err := GetPostBySlug("scheduled")
+	assert.Nil(t, err, "should get post without error")
+	assert.True(t, post.PublishAt.Equal(posts[2].PublishAt.Truncate(time.Second)))
+	assert.True(t, post.ExpiresAt.IsZero())
+}
+
+func TestSeriesAndAdjacentPosts(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	date := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	posts := []*Post{
+		{Slug: "part-2", Date: date.AddDate(0, 0, 1), Public: true, Series: "elf", SeriesOrder: 2},
+		{Slug: "part-1", Date: date.AddDate(0, 0, 2), Public: true, Series: "elf", SeriesOrder: 1},
+		{Slug: "other", Date: date.AddDate(0, 0, 3), Public: true},
+		{Slug: "part-3", Date: date.AddDate(0, 0, 4), Public: false, Series: "elf", SeriesOrder: 3},
+	}
+	for _, post := range posts {
+		assert.Nil(t, InsertPost(post), "should insert post without error")
+	}
+
+	series, err := GetSeriesPosts("elf")
+	assert.Nil(t, err, "should get series posts without error")
+	slugs := []string{}
+	for _, post := range series {
+		slugs = append(slugs, post.Slug)
+	}
+	assert.Equal(t, []string{"part-1", "part-2"}, slugs)
+	assert.Equal(t, "elf", series[0].Series)
+	assert.Equal(t, 1, series[0].SeriesOrder)
+
+	prev, next, err := GetAdjacentPosts(posts[1])
+	assert.Nil(t, err, "should get adjacent posts without error")
+	assert.Equal(t, "part-2", prev.Slug)
+	assert.Equal(t, "other", next.Slug)
+
+	// hidden posts are skipped
+	prev, next, err = GetAdjacentPosts(posts[2])
+	assert.Nil(t, err, "should get adjacent posts without error")
+	assert.Equal(t, "part-1", prev.Slug)
+	assert.Nil(t, next)
 }
@@ -0,0 +1,84 @@
+package blog
+
+import (
+	"database/sql"
+	"errors"
+	"html/template"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// The name of the post file in a post bundle. A bundle is a directory with
+// the post's index.md file and the other files that the post uses, such as
+// images, which are served under the post's URL.
+const BundleIndexFile = "index.md"
+
+// Checks whether a path in a posts filesystem is a post file, either a markdown
+// file at the root or the index file of a bundle.
+func IsPostFile(filepath string) bool {
+	dir, name := path.Split(filepath)
+	if dir == "" {
+		return strings.HasSuffix(name, ".md")
+	}
+	return IsBundleFile(filepath)
+}
+
+// Checks whether a path in a posts filesystem is the index file of a bundle.
+func IsBundleFile(filepath string) bool {
+	dir, name := path.Split(filepath)
+	return name == BundleIndexFile && dir != "" && !strings.Contains(strings.TrimSuffix(dir, "/"), "/")
+}
+
+// Lists the post files in the root of a filesystem and in its bundles.
+func PostFileNames(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name = path.Join(name, BundleIndexFile)
+			if _, err := fs.Stat(fsys, name); err != nil {
+				continue
+			}
+		}
+		if IsPostFile(name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Looks up the directory of the bundle that a post was loaded from. Returns
+// an empty string if the post was not loaded from a bundle.
+func GetBundleDir(slug string) (string, error) {
+	row := db.QueryRow("SELECT "+postFileColumns+" FROM post_files WHERE slug = ?", slug)
+	file, err := scanPostFile(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if !IsBundleFile(file.Path) {
+		return "", nil
+	}
+	return path.Dir(file.Path), nil
+}
+
+// Fills in the parts of a post that depend on the path of its file: the slug,
+// if it is not set, and the URLs of the files in its bundle.
+func applyFilePath(post *Post, filepath string) {
+	if post.Slug == "" {
+		post.Slug = SlugFromFilePath(filepath)
+	}
+	if IsBundleFile(filepath) {
+		post.Body = template.HTML(ResolveRelativeURLs(string(post.Body), "/blog/"+post.Slug+"/"))
+	}
+}
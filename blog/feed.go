@@ -1,55 +1,254 @@
 package blog
 
 import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
 	"io"
 	"strings"
 
 	"github.com/gorilla/feeds"
+	"github.com/mecha/mecha.dev/site"
 )
 
-func WriteFeed(w io.Writer, numItems, page int, format string) error {
-	posts, err := GetPosts(numItems, (page-1)*numItems)
+// The MIME types of the supported feed formats.
+var feedContentTypes = map[string]string{
+	"rss":  "application/rss+xml; charset=utf-8",
+	"atom": "application/atom+xml; charset=utf-8",
+	"json": "application/feed+json; charset=utf-8",
+}
+
+// Returns the MIME type for a feed format. Unknown formats are treated as RSS.
+func FeedContentType(format string) string {
+	contentType, ok := feedContentTypes[strings.ToLower(format)]
+	if !ok {
+		return feedContentTypes["rss"]
+	}
+	return contentType
+}
+
+// Options for writing a feed.
+type FeedOptions struct {
+	// Narrows down the posts included in the feed
+	Filter Filter
+	// The maximum number of items in the feed
+	NumItems int
+	// The page of items to write, starting at 1
+	Page int
+	// The feed format: "rss", "atom" or "json"
+	Format string
+	// Include the full post body in each item, with relative URLs made absolute
+	FullContent bool
+}
+
+// A feed of posts, which can be written in any of the feed formats.
+type PostFeed struct {
+	*feeds.Feed
+	posts []*Post
+}
+
+// Writes the feed of posts for a set of options.
+func WriteFeed(w io.Writer, opts FeedOptions) error {
+	feed, err := NewPostFeed(opts)
 	if err != nil {
 		return err
 	}
+	return feed.Write(w, opts.Format)
+}
+
+// Builds the feed of posts for a set of options. The format of the options is
+// only used when the feed is written.
+func NewPostFeed(opts FeedOptions) (*PostFeed, error) {
+	results, err := SearchPosts(opts.Filter, opts.NumItems, (opts.Page-1)*opts.NumItems)
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]*Post, len(results))
+	for i, result := range results {
+		posts[i] = result.Post
+	}
+
+	feed := BuildFeed(posts, opts.FullContent)
+
+	if tag := NormalizeTag(opts.Filter.Tag); tag != "" {
+		feed.Title += " #" + tag
+		feed.Link.Href += "/tag/" + tag
+	}
+	if author := strings.TrimSpace(opts.Filter.Author); author != "" {
+		feed.Title += " by " + author
+	}
+	if search := strings.TrimSpace(opts.Filter.Search); search != "" {
+		feed.Title += fmt.Sprintf(" matching %q", search)
+	}
+
+	return &PostFeed{feed, posts}, nil
+}
 
-	feed := BuildFeed(posts)
+// Writes the feed in a format: "rss", "atom" or "json". Unknown formats are
+// written as RSS.
+func (feed *PostFeed) Write(w io.Writer, format string) error {
+	posts := feed.posts
 
+	// categories are not part of the generic feed items, so they are added to
+	// the format-specific representations, with one category per tag
 	switch strings.ToLower(format) {
 	default:
 		fallthrough
 	case "rss":
-		feed.WriteRss(w)
+		rss := &rssFeedWithCategories{RssFeed: (&feeds.Rss{Feed: feed.Feed}).RssFeed()}
+		for i, item := range rss.RssFeed.Items {
+			rss.Items = append(rss.Items, &rssItemWithCategories{
+				RssItem:    item,
+				Categories: posts[i].Tags,
+			})
+		}
+		return feeds.WriteXML(rss, w)
 	case "atom":
-		feed.WriteAtom(w)
+		atom := &atomFeedWithCategories{AtomFeed: (&feeds.Atom{Feed: feed.Feed}).AtomFeed()}
+		for i, entry := range atom.AtomFeed.Entries {
+			categories := make([]atomCategory, len(posts[i].Tags))
+			for j, tag := range posts[i].Tags {
+				categories[j] = atomCategory{tag}
+			}
+			atom.Entries = append(atom.Entries, &atomEntryWithCategories{
+				AtomEntry:  entry,
+				Categories: categories,
+			})
+		}
+		return feeds.WriteXML(atom, w)
 	case "json":
-		feed.WriteJSON(w)
+		jsonFeed := &jsonFeedWithReading{JSONFeed: (&feeds.JSON{Feed: feed.Feed}).JSONFeed()}
+		for i, item := range jsonFeed.JSONFeed.Items {
+			item.Tags = posts[i].Tags
+			jsonFeed.Items = append(jsonFeed.Items, &jsonItemWithReading{
+				JSONItem: item,
+				Reading:  &jsonReading{posts[i].WordCount, posts[i].ReadingTime},
+			})
+		}
+		return writeJSONFeed(w, jsonFeed)
 	}
-
-	return nil
 }
 
-func BuildFeed(posts []*Post) *feeds.Feed {
+// Builds a feed from a list of posts. If fullContent is true, each item will
+// include the post's body with its relative URLs made absolute.
+func BuildFeed(posts []*Post, fullContent bool) *feeds.Feed {
+	config := site.Current
 	feed := &feeds.Feed{
-		Title:       "mecha.dev",
-		Description: "Posts from mecha's blog",
-		Link:        &feeds.Link{Href: "https://mecha.dev/blog"},
-		Author:      &feeds.Author{Name: "Miguel Muscat", Email: "mail@mecha.dev"},
+		Title:       config.Feed.Title,
+		Description: config.Feed.Description,
+		Link:        &feeds.Link{Href: config.URL("/blog")},
 		Items:       make([]*feeds.Item, 0),
 	}
 
+	if feed.Title == "" {
+		feed.Title = config.Name
+	}
+	if author := config.Author(); author.Name != "" {
+		feed.Author = &feeds.Author{Name: author.Name, Email: author.Email}
+	}
+
 	for _, post := range posts {
-		href := "https://mecha.dev/blog/" + post.Slug
+		href := config.URL("/blog/" + post.Slug)
+
+		author := feed.Author
+		if post.Author != "" {
+			author = &feeds.Author{Name: post.Author}
+		}
 
-		feed.Items = append(feed.Items, &feeds.Item{
+		item := &feeds.Item{
 			Id:          href,
 			Title:       post.Title,
 			Link:        &feeds.Link{Href: href},
 			Description: post.Excerpt,
-			Author:      feed.Author,
+			Author:      author,
 			Created:     post.Date,
-		})
+			Updated:     post.LastModified(),
+		}
+
+		if fullContent {
+			item.Content = AbsoluteURLs(string(post.Body), href)
+		}
+
+		if post.LastModified().After(feed.Updated) {
+			feed.Updated = post.LastModified()
+		}
+
+		feed.Items = append(feed.Items, item)
 	}
 
 	return feed
 }
+
+// An RSS feed whose items have a category element for each tag, since the
+// items of the feeds package only have a single category.
+type rssFeedWithCategories struct {
+	*feeds.RssFeed
+	Items []*rssItemWithCategories `xml:"item"`
+}
+
+type rssItemWithCategories struct {
+	*feeds.RssItem
+	Categories []string `xml:"category"`
+}
+
+// The root element of an RSS feed, like feeds.RssFeedXml.
+type rssFeedXml struct {
+	XMLName          xml.Name               `xml:"rss"`
+	Version          string                 `xml:"version,attr"`
+	ContentNamespace string                 `xml:"xmlns:content,attr"`
+	Channel          *rssFeedWithCategories `xml:"channel"`
+}
+
+func (rss *rssFeedWithCategories) FeedXml() any {
+	feedXml := rss.RssFeed.FeedXml().(*feeds.RssFeedXml)
+	return &rssFeedXml{
+		Version:          feedXml.Version,
+		ContentNamespace: feedXml.ContentNamespace,
+		Channel:          rss,
+	}
+}
+
+// An Atom feed whose entries have a category element for each tag, since the
+// entries of the feeds package only have a single category.
+type atomFeedWithCategories struct {
+	*feeds.AtomFeed
+	Entries []*atomEntryWithCategories `xml:"entry"`
+}
+
+type atomEntryWithCategories struct {
+	*feeds.AtomEntry
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func (atom *atomFeedWithCategories) FeedXml() any {
+	return atom
+}
+
+// A JSON feed whose items include the "_reading" extension.
+type jsonFeedWithReading struct {
+	*feeds.JSONFeed
+	Items []*jsonItemWithReading `json:"items,omitempty"`
+}
+
+type jsonItemWithReading struct {
+	*feeds.JSONItem
+	Reading *jsonReading `json:"_reading,omitempty"`
+}
+
+// A JSON feed extension with the length of a post.
+type jsonReading struct {
+	WordCount   int `json:"word_count"`
+	ReadingTime int `json:"minutes"`
+}
+
+// Writes a JSON feed the same way as feeds.Feed.WriteJSON does.
+func writeJSONFeed(w io.Writer, feed any) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(feed)
+}
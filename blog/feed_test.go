@@ -0,0 +1,123 @@
+package blog
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/mecha/mecha.dev/site"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedContentType(t *testing.T) {
+	assert.Equal(t, "application/rss+xml; charset=utf-8", FeedContentType("rss"))
+	assert.Equal(t, "application/atom+xml; charset=utf-8", FeedContentType("ATOM"))
+	assert.Equal(t, "application/feed+json; charset=utf-8", FeedContentType("json"))
+	assert.Equal(t, "application/rss+xml; charset=utf-8", FeedContentType("nope"))
+}
+
+func TestWriteFeedWithFilter(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	posts := []*Post{
+		{Slug: "post1", Title: "Post 1", Public: true, Tags: []string{"go"}, Author: "Alice", WordCount: 450, ReadingTime: 3},
+		{Slug: "post2", Title: "Post 2", Public: true, Tags: []string{"go"}, Author: "Bob"},
+		{Slug: "post3", Title: "Post 3", Public: true, Tags: []string{"rust"}, Author: "Alice"},
+	}
+	for _, post := range posts {
+		err = InsertPost(post)
+		assert.Nil(t, err, "should insert post without error")
+	}
+
+	var buf bytes.Buffer
+	err = WriteFeed(&buf, FeedOptions{
+		Filter:   Filter{Tag: "go", Author: "alice"},
+		NumItems: 10,
+		Page:     1,
+		Format:   "json",
+	})
+	assert.Nil(t, err, "should write feed without error")
+
+	feed := struct {
+		Items []struct {
+			Title   string   `json:"title"`
+			Tags    []string `json:"tags"`
+			Reading struct {
+				WordCount int `json:"word_count"`
+				Minutes   int `json:"minutes"`
+			} `json:"_reading"`
+		} `json:"items"`
+	}{}
+	err = json.Unmarshal(buf.Bytes(), &feed)
+	assert.Nil(t, err, "should write valid json")
+	assert.Len(t, feed.Items, 1)
+	assert.Equal(t, "Post 1", feed.Items[0].Title)
+	assert.Equal(t, []string{"go"}, feed.Items[0].Tags)
+	assert.Equal(t, 450, feed.Items[0].Reading.WordCount)
+	assert.Equal(t, 3, feed.Items[0].Reading.Minutes)
+}
+
+func TestBuildFeedFullContent(t *testing.T) {
+	site.Current = &site.Config{BaseURL: "https://mecha.dev"}
+	defer func() { site.Current = site.Default() }()
+
+	post := &Post{
+		Slug: "test",
+		Body: `<p><a href="/blog/other">other</a> <img src="/assets/a.png" srcset="/assets/a.480w.png 480w, /assets/a.png 800w"> <a href="#top">top</a> <a href="https://example.com">ext</a></p>`,
+	}
+
+	feed := BuildFeed([]*Post{post}, false)
+	assert.Equal(t, "", feed.Items[0].Content)
+
+	feed = BuildFeed([]*Post{post}, true)
+	assert.Equal(t, `<p><a href="https://mecha.dev/blog/other">other</a> <img src="https://mecha.dev/assets/a.png" srcset="https://mecha.dev/assets/a.480w.png 480w, https://mecha.dev/assets/a.png 800w"> <a href="https://mecha.dev/blog/test#top">top</a> <a href="https://example.com">ext</a></p>`, feed.Items[0].Content)
+}
+
+func TestWriteFeedCategories(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	err = InsertPost(&Post{Slug: "post1", Title: "Post 1", Public: true, Tags: []string{"go", "web"}})
+	assert.Nil(t, err, "should insert post without error")
+
+	var buf bytes.Buffer
+	err = WriteFeed(&buf, FeedOptions{NumItems: 10, Page: 1, Format: "rss"})
+	assert.Nil(t, err, "should write rss feed without error")
+
+	rss := struct {
+		Items []struct {
+			Title      string   `xml:"title"`
+			Categories []string `xml:"category"`
+		} `xml:"channel>item"`
+	}{}
+	err = xml.Unmarshal(buf.Bytes(), &rss)
+	assert.Nil(t, err, "should write valid xml")
+	assert.Len(t, rss.Items, 1)
+	assert.Equal(t, "Post 1", rss.Items[0].Title)
+	assert.Equal(t, []string{"go", "web"}, rss.Items[0].Categories, "should write a category per tag")
+
+	buf.Reset()
+	err = WriteFeed(&buf, FeedOptions{NumItems: 10, Page: 1, Format: "atom"})
+	assert.Nil(t, err, "should write atom feed without error")
+
+	atom := struct {
+		Entries []struct {
+			Title      string `xml:"title"`
+			Categories []struct {
+				Term string `xml:"term,attr"`
+			} `xml:"category"`
+		} `xml:"entry"`
+	}{}
+	err = xml.Unmarshal(buf.Bytes(), &atom)
+	assert.Nil(t, err, "should write valid xml")
+	assert.Len(t, atom.Entries, 1)
+	assert.Equal(t, "Post 1", atom.Entries[0].Title)
+	assert.Len(t, atom.Entries[0].Categories, 2, "should write a category per tag")
+	for i, tag := range []string{"go", "web"} {
+		assert.Equal(t, tag, atom.Entries[0].Categories[i].Term)
+	}
+}
@@ -0,0 +1,252 @@
+package blog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The directory on disk that post files are loaded from, if known. It is used
+// to look up when post files were last committed to git, for posts that do not
+// set an updated date in their front matter.
+var SourceDir string
+
+// Identifies the code and the assets that posts are rendered with. Posts that
+// were stored with a different key are rendered again, even if their files did
+// not change, so that persistent databases never serve outdated HTML. Main
+// derives it from the build version and the dimensions of the image assets.
+var RenderKey string
+
+// Information about the source file of a post, used to detect changes.
+type postFile struct {
+	Path  string
+	Slug  string
+	Hash  string
+	MTime time.Time
+	Size  int64
+	// The RenderKey that the post was rendered with
+	RenderKey string
+}
+
+const postFileColumns = "path, slug, hash, mtime, size, render_key"
+
+// Loads the posts in a filesystem into the database, from the markdown files
+// at its root and from its bundles. Only files that changed since they were
+// last loaded are parsed, and posts whose files no longer exist are removed.
+// Returns the number of parsed files.
+func LoadFromFs(fsys fs.FS) (int, error) {
+	names, err := PostFileNames(fsys)
+	if err != nil {
+		return 0, err
+	}
+
+	seen := map[string]bool{}
+	num, numUnchanged := 0, 0
+	for _, name := range names {
+		seen[name] = true
+
+		_, changed, err := LoadPostFile(fsys, name)
+		if err != nil {
+			return num, err
+		}
+
+		if changed {
+			num++
+		} else {
+			numUnchanged++
+		}
+	}
+
+	files, err := getPostFiles()
+	if err != nil {
+		return num, err
+	}
+
+	numRemoved := 0
+	for _, file := range files {
+		if seen[file.Path] {
+			continue
+		}
+		if _, err := UnloadPostFile(file.Path); err != nil {
+			return num, err
+		}
+		numRemoved++
+	}
+
+	slog.Info(
+		"blog: loaded blog posts from filesystem",
+		slog.Int("num", num),
+		slog.Int("unchanged", numUnchanged),
+		slog.Int("removed", numRemoved),
+	)
+
+	return num, nil
+}
+
+// Loads a post file into the database, unless it has not changed since it was
+// last loaded. Returns the post and whether the file was parsed.
+func LoadPostFile(fsys fs.FS, filepath string) (*Post, bool, error) {
+	info, err := fs.Stat(fsys, filepath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat post file: %w", err)
+	}
+
+	prev, err := getPostFile(filepath)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// posts that were rendered differently are rendered again
+	isRendered := prev != nil && prev.RenderKey == RenderKey
+
+	// embedded files have no modification time, so they are always hashed
+	mtime := info.ModTime().UTC()
+	if isRendered && !mtime.IsZero() && mtime.Equal(prev.MTime) && info.Size() == prev.Size {
+		return nil, false, nil
+	}
+
+	data, err := fs.ReadFile(fsys, filepath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read post file: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	file := &postFile{filepath, "", hex.EncodeToString(sum[:]), mtime, info.Size(), RenderKey}
+
+	if isRendered && file.Hash == prev.Hash {
+		file.Slug = prev.Slug
+		return nil, false, savePostFile(file)
+	}
+
+	post, err := parsePost(bytes.NewReader(data), filepath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse post file %s: %w", filepath, err)
+	}
+	if post.Updated.IsZero() {
+		post.Updated = fileUpdatedTime(filepath, mtime, post.Date)
+	}
+	file.Slug = post.Slug
+
+	// the slug may have changed in the front matter
+	if prev != nil && prev.Slug != post.Slug {
+		if _, err := DeletePost(prev.Slug); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if err := InsertPost(post); err != nil {
+		return nil, false, err
+	}
+	if err := savePostFile(file); err != nil {
+		return nil, false, err
+	}
+
+	return post, true, nil
+}
+
+// Determines when a post file was last updated, from its last git commit or
+// else from its modification time. Falls back to the post's date, and is never
+// earlier than it.
+func fileUpdatedTime(filepath string, mtime, date time.Time) time.Time {
+	updated := mtime
+	if commitTime, ok := gitCommitTime(filepath); ok {
+		updated = commitTime
+	}
+
+	if updated.Before(date) {
+		return date
+	}
+	return updated
+}
+
+// Looks up the time of the last git commit that changed a post file. Returns
+// false if SourceDir is not set, git is not installed or the file is not
+// committed.
+func gitCommitTime(filepath string) (time.Time, bool) {
+	if SourceDir == "" {
+		return time.Time{}, false
+	}
+
+	cmd := exec.Command("git", "log", "-1", "--format=%cI", "--", filepath)
+	cmd.Dir = SourceDir
+	out, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	commitTime, err := time.Parse(time.RFC3339, strings.TrimSpace(string(out)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return commitTime, true
+}
+
+// Removes the post that was loaded from a file. Returns whether the file was
+// previously loaded.
+func UnloadPostFile(filepath string) (bool, error) {
+	file, err := getPostFile(filepath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if _, err := DeletePost(file.Slug); err != nil {
+		return false, err
+	}
+
+	_, err = db.Exec("DELETE FROM post_files WHERE path = ?", filepath)
+	return true, err
+}
+
+func getPostFile(filepath string) (*postFile, error) {
+	row := db.QueryRow("SELECT "+postFileColumns+" FROM post_files WHERE path = ?", filepath)
+	return scanPostFile(row)
+}
+
+func getPostFiles() ([]*postFile, error) {
+	rows, err := db.Query("SELECT " + postFileColumns + " FROM post_files")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]*postFile, 0)
+	for rows.Next() {
+		file, err := scanPostFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+func savePostFile(file *postFile) error {
+	_, err := db.Exec(
+		"REPLACE INTO post_files ("+postFileColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		file.Path, file.Slug, file.Hash, file.MTime.Format(time.RFC3339Nano), file.Size, file.RenderKey,
+	)
+	return err
+}
+
+func scanPostFile(row interface{ Scan(...any) error }) (*postFile, error) {
+	file := &postFile{}
+	mtimeStr := ""
+
+	err := row.Scan(&file.Path, &file.Slug, &file.Hash, &mtimeStr, &file.Size, &file.RenderKey)
+	if err != nil {
+		return nil, err
+	}
+
+	file.MTime, err = time.Parse(time.RFC3339Nano, mtimeStr)
+	return file, err
+}
@@ -0,0 +1,151 @@
+package blog
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFromFsIncremental(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	mtime := time.Date(2025, 06, 29, 10, 15, 30, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"post1.md": {Data: []byte("title: Post 1\npublic: true\n---\nfirst"), ModTime: mtime},
+		"post2.md": {Data: []byte("title: Post 2\npublic: true\n---\nsecond"), ModTime: mtime},
+	}
+
+	num, err := LoadFromFs(fsys)
+	assert.Nil(t, err, "should load posts without error")
+	assert.Equal(t, 2, num)
+
+	num, err = LoadFromFs(fsys)
+	assert.Nil(t, err, "should reload posts without error")
+	assert.Equal(t, 0, num, "should skip unchanged files")
+
+	fsys["post1.md"] = &fstest.MapFile{Data: []byte("title: Post 1 (edited)\npublic: true\n---\nfirst"), ModTime: mtime.Add(time.Minute)}
+	delete(fsys, "post2.md")
+
+	num, err = LoadFromFs(fsys)
+	assert.Nil(t, err, "should reload posts without error")
+	assert.Equal(t, 1, num, "should only parse changed files")
+
+	post, err := GetPostBySlug("post1")
+	assert.Nil(t, err, "should get edited post without error")
+	assert.Equal(t, "Post 1 (edited)", post.Title)
+
+	count, err := NumPublicPosts()
+	assert.Nil(t, err, "should count posts without error")
+	assert.Equal(t, 1, count, "should remove posts of deleted files")
+}
+
+func TestLoadFromFsRenderKey(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	defer func() { RenderKey = "" }()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	fsys := fstest.MapFS{
+		"post.md": {Data: []byte("title: Post\npublic: true\n---\nbody"), ModTime: time.Now()},
+	}
+
+	RenderKey = "v1"
+	num, err := LoadFromFs(fsys)
+	assert.Nil(t, err, "should load posts without error")
+	assert.Equal(t, 1, num)
+
+	num, err = LoadFromFs(fsys)
+	assert.Nil(t, err, "should reload posts without error")
+	assert.Equal(t, 0, num, "should skip posts rendered with the same key")
+
+	RenderKey = "v2"
+	num, err = LoadFromFs(fsys)
+	assert.Nil(t, err, "should reload posts without error")
+	assert.Equal(t, 1, num, "should render unchanged posts again with a new key")
+
+	num, err = LoadFromFs(fsys)
+	assert.Nil(t, err, "should reload posts without error")
+	assert.Equal(t, 0, num, "should store the new key")
+}
+
+func TestInitDBFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blog.db")
+
+	err := InitDBFile(path)
+	assert.Nil(t, err, "should be able to init db without error")
+
+	err = InsertPost(&Post{Slug: "test", Public: true})
+	assert.Nil(t, err, "should insert post without error")
+	DestroyDB()
+
+	err = InitDBFile(path)
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to reopen db without error")
+
+	_, err = GetPostBySlug("test")
+	assert.Nil(t, err, "should keep posts between runs")
+}
+
+func TestLoadPostFileUpdated(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	mtime := time.Date(2025, 06, 29, 10, 15, 30, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"mtime.md":    {Data: []byte("title: A\ndate: 2025-06-01T00:00:00Z\n---\na"), ModTime: mtime},
+		"explicit.md": {Data: []byte("title: B\ndate: 2025-06-01T00:00:00Z\nupdated: 2025-06-10T00:00:00Z\n---\nb"), ModTime: mtime},
+		"older.md":    {Data: []byte("title: C\ndate: 2025-07-01T00:00:00Z\n---\nc"), ModTime: mtime},
+	}
+
+	_, err = LoadFromFs(fsys)
+	assert.Nil(t, err, "should load posts without error")
+
+	expected := map[string]time.Time{
+		"mtime":    mtime,
+		"explicit": time.Date(2025, 06, 10, 0, 0, 0, 0, time.UTC),
+		"older":    time.Date(2025, 07, 01, 0, 0, 0, 0, time.UTC),
+	}
+	for slug, updated := range expected {
+		post, err := GetPostBySlug(slug)
+		assert.Nil(t, err, "should get post without error")
+		assert.True(t, post.LastModified().Equal(updated), "%s: expected %v, got %v", slug, updated, post.LastModified())
+	}
+}
+
+func TestLoadFromFsBundles(t *testing.T) {
+	err := InitDB()
+	defer DestroyDB()
+	assert.Nil(t, err, "should be able to init db without error")
+
+	fsys := fstest.MapFS{
+		"post.md":              {Data: []byte("title: Post\npublic: true\n---\ntext")},
+		"bundle/index.md":      {Data: []byte("title: Bundle\npublic: true\n---\n![diagram](diagram.png) [post](../post) [top](#top) [home](/)")},
+		"bundle/diagram.png":   {Data: []byte("png")},
+		"no-index/diagram.png": {Data: []byte("png")},
+	}
+
+	num, err := LoadFromFs(fsys)
+	assert.Nil(t, err, "should load posts without error")
+	assert.Equal(t, 2, num, "should load posts and bundles")
+
+	post, err := GetPostBySlug("bundle")
+	assert.Nil(t, err, "should get bundle post by its directory name")
+	assert.Contains(t, string(post.Body), `src="/blog/bundle/diagram.png"`)
+	assert.Contains(t, string(post.Body), `href="/blog/post"`)
+	assert.Contains(t, string(post.Body), `href="#top"`)
+	assert.Contains(t, string(post.Body), `href="/"`)
+
+	dir, err := GetBundleDir("bundle")
+	assert.Nil(t, err, "should get bundle dir without error")
+	assert.Equal(t, "bundle", dir)
+
+	dir, err = GetBundleDir("post")
+	assert.Nil(t, err, "should get bundle dir without error")
+	assert.Equal(t, "", dir, "should not have a bundle dir for plain posts")
+}
@@ -2,13 +2,17 @@ package blog
 
 import (
 	"fmt"
+	"html"
 	"html/template"
 	"io"
 	"io/fs"
 	"log/slog"
 	"path"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/mecha/mecha.dev/md"
 )
@@ -20,6 +24,56 @@ type Post struct {
 	Body    template.HTML
 	Date    time.Time
 	Public  bool
+	Tags    []string
+	Author  string
+	// The time that the post was last changed. Optional when parsing, in which
+	// case it is filled in when the post file is loaded.
+	Updated time.Time
+	// The time from which the post is listed, instead of its date. Optional.
+	PublishAt time.Time
+	// The time from which the post is no longer listed. Optional.
+	ExpiresAt time.Time
+	// The name of the series that the post is a part of. Optional.
+	Series string
+	// The position of the post in its series.
+	SeriesOrder int
+	// The headings in the post's body
+	Outline []md.Heading
+	// Whether to show a table of contents built from the outline
+	ShowTOC bool
+	// The number of words in the post's text, excluding code blocks
+	WordCount int
+	// The estimated time to read the post, in minutes
+	ReadingTime int
+}
+
+// The reading speed used to estimate the reading time of posts.
+const WordsPerMinute = 200
+
+// Checks whether a post is listed at a given time. This mirrors the
+// visibleCondition used by queries.
+func (post *Post) IsVisible(now time.Time) bool {
+	publishAt := post.PublishAt
+	if publishAt.IsZero() {
+		publishAt = post.Date
+	}
+	return post.Public &&
+		!publishAt.After(now) &&
+		(post.ExpiresAt.IsZero() || post.ExpiresAt.After(now))
+}
+
+// Returns the time that a post was last changed, which is its date if it has
+// no updated time.
+func (post *Post) LastModified() time.Time {
+	if post.Updated.After(post.Date) {
+		return post.Updated
+	}
+	return post.Date
+}
+
+// Checks whether a post was changed on a later day than it was posted.
+func (post *Post) WasUpdated() bool {
+	return post.LastModified().Truncate(24 * time.Hour).After(post.Date.Truncate(24 * time.Hour))
 }
 
 func ParsePostFile(fsys fs.FS, filepath string) (*Post, error) {
@@ -28,56 +82,140 @@ func ParsePostFile(fsys fs.FS, filepath string) (*Post, error) {
 		return nil, fmt.Errorf("failed to open post file: %w", err)
 	}
 
-	post, err := ParsePost(file)
+	return parsePost(file, filepath)
+}
+
+// The front matter of a post file.
+type FrontMatter struct {
+	Slug    string    `yaml:"slug"`
+	Title   string    `yaml:"title"`
+	Excerpt string    `yaml:"excerpt"`
+	Author  string    `yaml:"author"`
+	Tags    md.List   `yaml:"tags"`
+	Public  bool      `yaml:"public"`
+	Date    time.Time `yaml:"date"`
+	Updated time.Time `yaml:"updated"`
+
+	PublishAt time.Time `yaml:"publish_at"`
+	ExpiresAt time.Time `yaml:"expires_at"`
+
+	Series      string `yaml:"series"`
+	SeriesOrder int    `yaml:"series_order"`
+
+	// Whether to show a table of contents. Defaults to true.
+	TOC *bool `yaml:"toc"`
+}
+
+func ParsePost(reader io.Reader) (*Post, error) {
+	return parsePost(reader, "")
+}
+
+// Parses a post from its file's content, and warns about unknown front matter
+// keys. See PostFromDoc for the filepath.
+func parsePost(reader io.Reader, filepath string) (*Post, error) {
+	doc, err := md.Parse(reader)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse post markdown: %w", err)
 	}
 
-	if post.Slug == "" {
-		post.Slug = SlugFromFilePath(filepath)
+	for _, key := range doc.Head.UnknownKeys(&FrontMatter{}) {
+		slog.Warn("blog: unknown post property", "property", key.Name, slog.Int("line", key.Line))
 	}
 
-	return post, nil
+	return PostFromDoc(doc, filepath)
 }
 
-func ParsePost(reader io.Reader) (*Post, error) {
+// Creates a post from its parsed markdown, without warning about unknown front
+// matter keys. The filepath is the path of the post's file in a posts
+// filesystem, or empty if the post was not read from a file.
+func PostFromDoc(doc *md.ParsedDoc, filepath string) (*Post, error) {
+	head := FrontMatter{}
+	if err := doc.Head.Decode(&head); err != nil {
+		return nil, fmt.Errorf("invalid post front matter: %w", err)
+	}
+
 	post := &Post{
-		Date: time.Now(),
+		Slug:    head.Slug,
+		Title:   head.Title,
+		Excerpt: head.Excerpt,
+		Body:    doc.Body,
+		Date:    head.Date,
+		Updated: head.Updated,
+		Public:  head.Public,
+		Tags:    ParseTags(strings.Join(head.Tags, ",")),
+		Author:  head.Author,
+
+		PublishAt: head.PublishAt,
+		ExpiresAt: head.ExpiresAt,
+
+		Series:      head.Series,
+		SeriesOrder: head.SeriesOrder,
+
+		Outline: doc.Outline,
+		ShowTOC: head.TOC == nil || *head.TOC,
+
+		WordCount:   doc.WordCount,
+		ReadingTime: readingTime(doc.WordCount),
 	}
 
-	doc, err := md.Parse(reader)
-	if err != nil {
-		return post, fmt.Errorf("failed to parse post markdown: %w", err)
+	if post.Date.IsZero() {
+		post.Date = time.Now()
 	}
 
-	post.Body = doc.Body
-
-	for name, value := range doc.Head {
-		switch strings.ToLower(name) {
-		case "slug":
-			post.Slug = value
-		case "title":
-			post.Title = value
-		case "excerpt":
-			post.Excerpt = value
-		case "public":
-			post.Public = strings.ToLower(value) == "true"
-		case "date":
-			date, err := time.Parse(time.RFC3339, value)
-			if err != nil {
-				return nil, err
-			}
-			post.Date = date
-		default:
-			slog.Warn("blog: unknown post property", "property", name)
-		}
+	if filepath != "" {
+		applyFilePath(post, filepath)
 	}
 
 	return post, nil
 }
 
+// Estimates the time to read a number of words, in whole minutes. Posts with
+// any text take at least a minute to read.
+func readingTime(wordCount int) int {
+	return (wordCount + WordsPerMinute - 1) / WordsPerMinute
+}
+
+// Derives a post's slug from the name of its file, or the name of its bundle's
+// directory for bundles.
 func SlugFromFilePath(filepath string) string {
+	if IsBundleFile(filepath) {
+		return path.Base(path.Dir(filepath))
+	}
 	base := path.Base(filepath)
 	ext := path.Ext(filepath)
 	return base[:len(base)-len(ext)]
 }
+
+// Parses a comma-separated list of tags. Tags are normalized and de-duplicated.
+func ParseTags(list string) []string {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		tag = NormalizeTag(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// Spells out the symbols that tell tags apart, such as in "c#" and "c++".
+var tagSymbolReplacer = strings.NewReplacer("#", " sharp ", "+", " plus ")
+
+// Normalizes a tag name into its lowercase, dash-separated form. Tags only
+// keep letters and digits, so that they can be used as-is in URLs and paths.
+func NormalizeTag(tag string) string {
+	tag = tagSymbolReplacer.Replace(strings.ToLower(tag))
+	words := strings.FieldsFunc(tag, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// Converts an HTML string into plain text, for indexing.
+func plainText(body template.HTML) string {
+	text := htmlTagRegex.ReplaceAllString(string(body), " ")
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
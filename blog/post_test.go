@@ -2,9 +2,11 @@ package blog
 
 import (
 	"bytes"
+	"net/url"
 	"testing"
 	"time"
 
+	"github.com/mecha/mecha.dev/md"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,3 +35,80 @@ func TestParsePost(t *testing.T) {
 	assert.True(t, post.Date.Equal(expDate))
 	assert.Equal(t, "<p>hello <strong>world</strong></p>", string(post.Body))
 }
+
+func TestParsePostYAMLFrontMatter(t *testing.T) {
+	raw := []byte(`---
+title: "Lists: a primer"
+excerpt: >
+  A multi-line
+  excerpt.
+tags:
+  - Go
+  - Web Dev
+public: true
+date: 2025-02-01T14:42:55Z
+---
+
+hello
+`)
+
+	post, err := ParsePost(bytes.NewReader(raw))
+
+	assert.Nil(t, err, "should not err")
+	assert.Equal(t, "Lists: a primer", post.Title)
+	assert.Equal(t, "A multi-line excerpt.\n", post.Excerpt)
+	assert.Equal(t, []string{"go", "web-dev"}, post.Tags)
+	assert.True(t, post.Public)
+	assert.Equal(t, 2025, post.Date.Year())
+	assert.Equal(t, "<p>hello</p>", string(post.Body))
+}
+
+func TestParsePostFrontMatterError(t *testing.T) {
+	raw := []byte("---\ntitle: ok\ndate: yesterday\n---\nhello\n")
+
+	_, err := ParsePost(bytes.NewReader(raw))
+
+	var fmErr *md.FrontMatterError
+	assert.ErrorAs(t, err, &fmErr)
+	assert.Equal(t, 3, fmErr.Line)
+}
+
+func TestParsePostOutline(t *testing.T) {
+	post, err := ParsePost(bytes.NewReader([]byte("title: x\n---\n## One\n\n## Two\n")))
+	assert.Nil(t, err, "should not err")
+	assert.True(t, post.ShowTOC)
+	assert.Equal(t, []md.Heading{{Level: 2, Text: "One", ID: "one"}, {Level: 2, Text: "Two", ID: "two"}}, post.Outline)
+
+	post, err = ParsePost(bytes.NewReader([]byte("title: x\ntoc: false\n---\n## One\n")))
+	assert.Nil(t, err, "should not err")
+	assert.False(t, post.ShowTOC)
+	assert.Len(t, post.Outline, 1)
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags(" Go, linux ,, Web Dev, go")
+	assert.Equal(t, []string{"go", "linux", "web-dev"}, tags)
+	assert.Nil(t, ParseTags(""))
+}
+
+func TestNormalizeTag(t *testing.T) {
+	cases := map[string]string{
+		"Web Dev": "web-dev",
+		"c#":      "c-sharp",
+		"C++":     "c-plus-plus",
+		"a/b":     "a-b",
+		"100%":    "100",
+		"?":       "",
+		"what?":   "what",
+		"Café":    "café",
+	}
+	for tag, expected := range cases {
+		assert.Equal(t, expected, NormalizeTag(tag), "tag: %q", tag)
+	}
+
+	tags := ParseTags("c#, a/b, 100%, ?")
+	assert.Equal(t, []string{"100", "a-b", "c-sharp"}, tags)
+	for _, tag := range tags {
+		assert.Equal(t, url.PathEscape(tag), tag, "tags should be safe to use in URLs")
+	}
+}
@@ -0,0 +1,61 @@
+package blog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoPreviewSecret     = errors.New("no preview secret is configured")
+	ErrInvalidPreviewToken = errors.New("invalid preview token")
+	ErrExpiredPreviewToken = errors.New("expired preview token")
+)
+
+// Creates a token that grants access to a post that is not visible yet, until
+// the token expires. The token is signed with a secret that is only known to
+// the server, so it cannot be forged or reused for other posts.
+func NewPreviewToken(slug string, expires time.Time, secret []byte) (string, error) {
+	if len(secret) == 0 {
+		return "", ErrNoPreviewSecret
+	}
+
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+	return expiresStr + "." + signPreview(slug, expiresStr, secret), nil
+}
+
+// Checks that a preview token was created for a post and has not expired.
+func VerifyPreviewToken(slug, token string, now time.Time, secret []byte) error {
+	if len(secret) == 0 {
+		return ErrNoPreviewSecret
+	}
+
+	expiresStr, sig, found := strings.Cut(token, ".")
+	if !found {
+		return ErrInvalidPreviewToken
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(signPreview(slug, expiresStr, secret))) {
+		return ErrInvalidPreviewToken
+	}
+
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return ErrInvalidPreviewToken
+	}
+	if now.Unix() >= expires {
+		return ErrExpiredPreviewToken
+	}
+
+	return nil
+}
+
+func signPreview(slug, expiresStr string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(slug + "\n" + expiresStr))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
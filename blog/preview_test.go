@@ -0,0 +1,41 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewToken(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Date(2025, 6, 29, 10, 0, 0, 0, time.UTC)
+
+	token, err := NewPreviewToken("draft", now.Add(time.Hour), secret)
+	assert.Nil(t, err, "should create token without error")
+
+	assert.Nil(t, VerifyPreviewToken("draft", token, now, secret))
+	assert.ErrorIs(t, VerifyPreviewToken("other", token, now, secret), ErrInvalidPreviewToken)
+	assert.ErrorIs(t, VerifyPreviewToken("draft", token, now, []byte("wrong")), ErrInvalidPreviewToken)
+	assert.ErrorIs(t, VerifyPreviewToken("draft", token, now.Add(2*time.Hour), secret), ErrExpiredPreviewToken)
+	assert.ErrorIs(t, VerifyPreviewToken("draft", "garbage", now, secret), ErrInvalidPreviewToken)
+	assert.ErrorIs(t, VerifyPreviewToken("draft", token, now, nil), ErrNoPreviewSecret)
+
+	// the expiry time cannot be extended without the secret
+	_, sig, _ := strings.Cut(token, ".")
+	assert.ErrorIs(t, VerifyPreviewToken("draft", "99999999999."+sig, now, secret), ErrInvalidPreviewToken)
+
+	_, err = NewPreviewToken("draft", now, nil)
+	assert.ErrorIs(t, err, ErrNoPreviewSecret)
+}
+
+func TestPostIsVisible(t *testing.T) {
+	now := time.Date(2025, 6, 29, 10, 0, 0, 0, time.UTC)
+
+	assert.True(t, (&Post{Public: true, Date: now.Add(-time.Hour)}).IsVisible(now))
+	assert.False(t, (&Post{Public: false, Date: now.Add(-time.Hour)}).IsVisible(now))
+	assert.False(t, (&Post{Public: true, Date: now.Add(time.Hour)}).IsVisible(now))
+	assert.True(t, (&Post{Public: true, Date: now.Add(time.Hour), PublishAt: now}).IsVisible(now))
+	assert.False(t, (&Post{Public: true, Date: now.Add(-time.Hour), ExpiresAt: now}).IsVisible(now))
+}
@@ -0,0 +1,85 @@
+package blog
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Matches href and src attributes in HTML, capturing the attribute value.
+var urlAttrRegex = regexp.MustCompile(`(\s(?:href|src)=")([^"]*)(")`)
+
+// Matches srcset attributes in HTML, capturing the attribute value.
+var srcsetAttrRegex = regexp.MustCompile(`(\ssrcset=")([^"]*)(")`)
+
+// Rewrites the URLs in the href, src and srcset attributes of an HTML string
+// into absolute URLs, resolved against the absolute URL of the document.
+func AbsoluteURLs(html, docURL string) string {
+	base, err := url.Parse(docURL)
+	if err != nil {
+		return html
+	}
+
+	return rewriteURLs(html, func(urlStr string) string {
+		return resolveURL(base, urlStr)
+	})
+}
+
+// Rewrites the relative path URLs in the href, src and srcset attributes of an
+// HTML string, such as "diagram.png", into URLs under a base path. Absolute
+// paths, fragments and URLs with a scheme are left as-is.
+func ResolveRelativeURLs(html, basePath string) string {
+	base, err := url.Parse(basePath)
+	if err != nil {
+		return html
+	}
+
+	return rewriteURLs(html, func(urlStr string) string {
+		ref, err := url.Parse(urlStr)
+		if err != nil || ref.Scheme != "" || ref.Host != "" || ref.Path == "" || strings.HasPrefix(ref.Path, "/") {
+			return urlStr
+		}
+		return base.ResolveReference(ref).String()
+	})
+}
+
+// Rewrites the URLs in the href, src and srcset attributes of an HTML string.
+func rewriteURLs(html string, rewrite func(string) string) string {
+	html = urlAttrRegex.ReplaceAllStringFunc(html, func(attr string) string {
+		parts := urlAttrRegex.FindStringSubmatch(attr)
+		return parts[1] + rewrite(parts[2]) + parts[3]
+	})
+
+	// srcset values are comma-separated lists of "<url> <descriptor>"
+	return srcsetAttrRegex.ReplaceAllStringFunc(html, func(attr string) string {
+		parts := srcsetAttrRegex.FindStringSubmatch(attr)
+		candidates := strings.Split(parts[2], ",")
+		for i, candidate := range candidates {
+			fields := strings.Fields(candidate)
+			if len(fields) > 0 {
+				fields[0] = rewrite(fields[0])
+				candidates[i] = strings.Join(fields, " ")
+			}
+		}
+		return parts[1] + strings.Join(candidates, ", ") + parts[3]
+	})
+}
+
+// Resolves a URL against a base URL, leaving absolute and invalid URLs as-is.
+func resolveURL(base *url.URL, urlStr string) string {
+	ref, err := url.Parse(urlStr)
+	if err != nil || ref.IsAbs() {
+		return urlStr
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// Extracts the URLs in the href and src attributes of an HTML string.
+func ExtractURLs(htmlStr string) []string {
+	urls := []string{}
+	for _, parts := range urlAttrRegex.FindAllStringSubmatch(htmlStr, -1) {
+		urls = append(urls, html.UnescapeString(parts[2]))
+	}
+	return urls
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The Cache-Control header for responses to paths that start with a prefix.
+type cacheControlRule struct {
+	Prefix string
+	Value  string
+}
+
+// The Cache-Control headers for routes that change less often than pages. The
+// first matching rule is used.
+var cacheControlRules = []cacheControlRule{
+	{"/assets/", "public, max-age=86400"},
+	{"/blog/feed", "public, max-age=900"},
+	{"/sitemap", "public, max-age=3600"},
+	{"/robots.txt", "public, max-age=86400"},
+}
+
+// The Cache-Control header for pages, which are kept short so that new posts
+// and edits show up quickly.
+const defaultCacheControl = "public, max-age=60, must-revalidate"
+
+// The Cache-Control header for fingerprinted assets, whose URLs change along
+// with their content.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// Adds an ETag and Cache-Control header to successful GET responses, and
+// responds with 304 Not Modified if the client already has the same content.
+// Handlers can set a Last-Modified header to also support If-Modified-Since,
+// or set their own Cache-Control header to override the route defaults.
+func cacheHandler(handler http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			handler.ServeHTTP(w, req)
+			return
+		}
+
+		// HEAD requests are rendered like GET requests, so that they get the
+		// same headers, and their body is dropped when it is written
+		getReq := req
+		if req.Method == http.MethodHead {
+			getReq = req.Clone(req.Context())
+			getReq.Method = http.MethodGet
+		}
+
+		buf := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+		handler.ServeHTTP(buf, getReq)
+
+		header := w.Header()
+		if buf.status != http.StatusOK || strings.Contains(header.Get("Cache-Control"), "no-store") {
+			buf.writeTo(w, req)
+			return
+		}
+
+		if header.Get("Cache-Control") == "" {
+			header.Set("Cache-Control", cacheControlFor(req.URL.Path))
+		}
+
+		etag := contentETag(buf.body.Bytes())
+		header.Set("ETag", etag)
+
+		if isNotModified(req, etag, header.Get("Last-Modified")) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		buf.writeTo(w, req)
+	}
+}
+
+func cacheControlFor(path string) string {
+	for _, rule := range cacheControlRules {
+		if strings.HasPrefix(path, rule.Prefix) {
+			return rule.Value
+		}
+	}
+	return defaultCacheControl
+}
+
+// Creates a weak ETag from the content of a response and the build version,
+// so that a new build never matches the ETags of the old one. The ETag is weak
+// because the response may or may not be compressed.
+func contentETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `W/"` + Version + "-" + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// Checks the conditional headers of a request against a response. If-None-Match
+// takes precedence over If-Modified-Since, as per RFC 9110.
+func isNotModified(req *http.Request, etag, lastModified string) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince := req.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || lastModified == "" {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// Buffers a response so that it can be inspected before it is written. The
+// header is shared with the underlying writer.
+type bufferedResponseWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (bw *bufferedResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(status int) {
+	if !bw.wroteHeader {
+		bw.status = status
+		bw.wroteHeader = true
+	}
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	bw.wroteHeader = true
+	return bw.body.Write(b)
+}
+
+func (bw *bufferedResponseWriter) writeTo(w http.ResponseWriter, req *http.Request) {
+	// the content type is detected here, since handlers may write the status
+	// before any content and it cannot be detected from compressed content
+	if bw.body.Len() > 0 && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(bw.body.Bytes()))
+	}
+
+	if req.Method == http.MethodHead {
+		if bw.body.Len() > 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(bw.body.Len()))
+		}
+		w.WriteHeader(bw.status)
+		return
+	}
+
+	w.WriteHeader(bw.status)
+	w.Write(bw.body.Bytes())
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testModTime = time.Date(2025, 06, 29, 10, 15, 30, 0, time.UTC)
+
+func newCacheTestServer() *httptest.Server {
+	return httptest.NewServer(gzipHandler(cacheHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Last-Modified", testModTime.Format(http.TimeFormat))
+		// like http.ServeContent, the body is only written for GET requests
+		if req.Method != http.MethodHead {
+			w.Write([]byte("<p>Hello world</p>"))
+		}
+	}))))
+}
+
+func doCacheRequest(t *testing.T, method, url string, header map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, nil)
+	assert.Nil(t, err, "should create request without error")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	res, err := http.DefaultTransport.RoundTrip(req)
+	assert.Nil(t, err, "should send request without error")
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err, "should read body without error")
+	return res, string(body)
+}
+
+func TestCacheHandlerGetAndHead(t *testing.T) {
+	server := newCacheTestServer()
+	defer server.Close()
+
+	get, body := doCacheRequest(t, http.MethodGet, server.URL, nil)
+	assert.Equal(t, http.StatusOK, get.StatusCode)
+	assert.Equal(t, "<p>Hello world</p>", body)
+	assert.NotEmpty(t, get.Header.Get("ETag"))
+	assert.Equal(t, defaultCacheControl, get.Header.Get("Cache-Control"))
+
+	head, body := doCacheRequest(t, http.MethodHead, server.URL, nil)
+	assert.Equal(t, http.StatusOK, head.StatusCode)
+	assert.Empty(t, body)
+	assert.Equal(t, get.Header.Get("ETag"), head.Header.Get("ETag"), "should have the same etag as a GET request")
+	assert.Equal(t, get.Header.Get("Content-Type"), head.Header.Get("Content-Type"))
+	assert.Equal(t, "18", head.Header.Get("Content-Length"))
+
+	gzipHeader := map[string]string{"Accept-Encoding": "gzip"}
+	gzipGet, _ := doCacheRequest(t, http.MethodGet, server.URL, gzipHeader)
+	gzipHead, body := doCacheRequest(t, http.MethodHead, server.URL, gzipHeader)
+	assert.Equal(t, "gzip", gzipHead.Header.Get("Content-Encoding"))
+	assert.Empty(t, body)
+	assert.Equal(t, gzipGet.Header.Get("ETag"), gzipHead.Header.Get("ETag"), "should have the same etag as a GET request")
+	assert.Empty(t, gzipHead.Header.Get("Content-Length"), "should not report the length of an empty gzip stream")
+}
+
+func TestCacheHandlerIfNoneMatch(t *testing.T) {
+	server := newCacheTestServer()
+	defer server.Close()
+
+	get, _ := doCacheRequest(t, http.MethodGet, server.URL, nil)
+	etag := get.Header.Get("ETag")
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		res, body := doCacheRequest(t, method, server.URL, map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, method)
+		assert.Empty(t, body)
+		assert.Equal(t, etag, res.Header.Get("ETag"))
+
+		res, _ = doCacheRequest(t, method, server.URL, map[string]string{
+			"If-None-Match":     `W/"other"`,
+			"If-Modified-Since": testModTime.Format(http.TimeFormat),
+		})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "%s: if-none-match should take precedence", method)
+	}
+}
+
+func TestCacheHandlerIfModifiedSince(t *testing.T) {
+	server := newCacheTestServer()
+	defer server.Close()
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		res, body := doCacheRequest(t, method, server.URL, map[string]string{"If-Modified-Since": testModTime.Format(http.TimeFormat)})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, method)
+		assert.Empty(t, body)
+
+		res, _ = doCacheRequest(t, method, server.URL, map[string]string{"If-Modified-Since": testModTime.Add(-time.Hour).Format(http.TimeFormat)})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "%s: should respond if modified since", method)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/mecha/mecha.dev/blog"
+	"github.com/mecha/mecha.dev/md"
+	"github.com/mecha/mecha.dev/projects"
+	"github.com/mecha/mecha.dev/site"
+)
+
+// A problem found in a content file by the check command.
+type checkProblem struct {
+	File string
+	// The line number of the problem in the file, or zero if unknown
+	Line int
+	Msg  string
+}
+
+func (p checkProblem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Msg)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Msg)
+}
+
+type checkedBody struct {
+	File string
+	HTML template.HTML
+}
+
+// Validates content files, collecting the problems that it finds.
+type contentChecker struct {
+	problems []checkProblem
+	// The file that each post slug was found in
+	slugs map[string]string
+	// The files of the posts that are bundles, by slug
+	bundles map[string]fs.FS
+	// The rendered HTML of the checked files, for checking links
+	bodies []checkedBody
+	// The files served under /assets/
+	assetsFS fs.FS
+}
+
+// Checks the posts and projects for problems without loading them into the
+// database, and prints any problems that are found. Returns the number of
+// problems.
+func runCheck() (int, error) {
+	c := &contentChecker{
+		slugs:    map[string]string{},
+		bundles:  map[string]fs.FS{},
+		assetsFS: getFS(PublicDir),
+	}
+
+	postsFS := getFS(PostsDir)
+	postNames, err := blog.PostFileNames(postsFS)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range postNames {
+		c.checkPost(postsFS, name, path.Join(PostsDir, name))
+	}
+
+	projectsFS := getFS(ProjectsDir)
+	projectNames, err := mdFileNames(projectsFS)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range projectNames {
+		c.checkProject(projectsFS, name, path.Join(ProjectsDir, name))
+	}
+
+	// links are checked last, once the slugs of all posts are known
+	for _, body := range c.bodies {
+		c.checkLinks(body.File, body.HTML)
+	}
+
+	for _, problem := range c.problems {
+		fmt.Println(problem)
+	}
+
+	slog.Info(
+		"check: checked content files",
+		slog.Int("num", len(postNames)+len(projectNames)),
+		slog.Int("problems", len(c.problems)),
+	)
+
+	return len(c.problems), nil
+}
+
+func (c *contentChecker) checkPost(fsys fs.FS, name, file string) {
+	doc := c.checkDoc(fsys, name, file, &blog.FrontMatter{})
+	if doc == nil {
+		return
+	}
+
+	// the unknown keys are already reported, so they are not logged again
+	post, err := blog.PostFromDoc(doc, name)
+	if err != nil {
+		c.addErr(file, err)
+		return
+	}
+
+	if post.Title == "" {
+		c.add(file, 0, "missing title")
+	}
+	if post.Excerpt == "" {
+		c.add(file, 0, "missing excerpt")
+	}
+
+	if other, isDupe := c.slugs[post.Slug]; isDupe {
+		c.add(file, 0, fmt.Sprintf("duplicate slug %q, also used by %s", post.Slug, other))
+	} else {
+		c.slugs[post.Slug] = file
+	}
+
+	if blog.IsBundleFile(name) {
+		c.bundles[post.Slug] = getFS(path.Join(PostsDir, path.Dir(name)))
+	}
+
+	c.bodies = append(c.bodies, checkedBody{file, post.Body})
+}
+
+func (c *contentChecker) checkProject(fsys fs.FS, name, file string) {
+	doc := c.checkDoc(fsys, name, file, &projects.FrontMatter{})
+	if doc == nil {
+		return
+	}
+
+	project, err := projects.FromDoc(doc)
+	if err != nil {
+		c.addErr(file, err)
+		return
+	}
+
+	if project.Name == "" {
+		c.add(file, 0, "missing name")
+	}
+
+	c.bodies = append(c.bodies, checkedBody{file, project.Body})
+}
+
+// Checks the front matter keys and code blocks of a markdown file. Returns the
+// parsed file, or nil if it could not be parsed.
+func (c *contentChecker) checkDoc(fsys fs.FS, name, file string, head any) *md.ParsedDoc {
+	reader, err := fsys.Open(name)
+	if err != nil {
+		c.addErr(file, err)
+		return nil
+	}
+	defer reader.Close()
+
+	doc, err := md.Parse(reader)
+	if err != nil {
+		c.addErr(file, err)
+		return nil
+	}
+
+	for _, key := range doc.Head.UnknownKeys(head) {
+		c.add(file, key.Line, fmt.Sprintf("unknown front matter key %q", key.Name))
+	}
+
+	for _, lang := range doc.CodeLangs {
+		if !md.IsKnownLang(lang) {
+			c.add(file, 0, fmt.Sprintf("unknown code block language %q", lang))
+		}
+	}
+
+	return doc
+}
+
+// Checks that the links in an HTML body to posts and assets point to content
+// that exists.
+func (c *contentChecker) checkLinks(file string, body template.HTML) {
+	for _, rawURL := range blog.ExtractURLs(string(body)) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			c.add(file, 0, fmt.Sprintf("invalid URL %q", rawURL))
+			continue
+		}
+
+		// only check absolute URLs that point to this site
+		if u.Host != "" && !strings.HasPrefix(rawURL, site.Current.BaseURL+"/") {
+			continue
+		}
+
+		if assetPath, isAsset := strings.CutPrefix(u.Path, "/assets/"); isAsset {
+			if _, err := fs.Stat(c.assetsFS, assetPath); err != nil {
+				c.add(file, 0, fmt.Sprintf("missing asset %q", rawURL))
+			}
+		} else if subPath, isPost := strings.CutPrefix(u.Path, "/blog/"); isPost {
+			slug, bundleFile, _ := strings.Cut(strings.TrimSuffix(subPath, "/"), "/")
+			if _, exists := c.slugs[slug]; !exists && !isBlogRoute(subPath) {
+				c.add(file, 0, fmt.Sprintf("broken link to post %q", rawURL))
+			} else if bundleFile != "" && !isBlogRoute(subPath) && !c.bundleFileExists(slug, bundleFile) {
+				c.add(file, 0, fmt.Sprintf("missing bundle file %q", rawURL))
+			}
+		}
+	}
+}
+
+// Checks whether a file exists in the bundle of a post.
+func (c *contentChecker) bundleFileExists(slug, name string) bool {
+	bundleFS, isBundle := c.bundles[slug]
+	if !isBundle {
+		return false
+	}
+	_, err := fs.Stat(bundleFS, name)
+	return err == nil
+}
+
+func (c *contentChecker) add(file string, line int, msg string) {
+	c.problems = append(c.problems, checkProblem{file, line, msg})
+}
+
+// Adds a problem for an error, or for each error that it joins. Front matter
+// errors keep their line numbers.
+func (c *contentChecker) addErr(file string, err error) {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		for _, err := range joined.Unwrap() {
+			c.addErr(file, err)
+		}
+		return
+	}
+
+	var fmErr *md.FrontMatterError
+	if errors.As(err, &fmErr) {
+		c.add(file, fmErr.Line, fmErr.Err.Error())
+	} else {
+		c.add(file, 0, err.Error())
+	}
+}
+
+// Checks whether a path under /blog/ is handled by a route other than a post.
+func isBlogRoute(subPath string) bool {
+	first, _, _ := strings.Cut(subPath, "/")
+	return first == "" || first == "tags" || first == "tag" || first == "page" || strings.HasPrefix(first, "feed")
+}
+
+// Lists the names of the markdown files in the root of a filesystem.
+func mdFileNames(fsys fs.FS) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".md") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mecha/mecha.dev/assets"
+	"github.com/mecha/mecha.dev/blog"
+	"github.com/mecha/mecha.dev/images"
+)
+
+// A route to render during a static export.
+type exportRoute struct {
+	// The URL path to request
+	URL string
+	// The expected HTTP status code of the response
+	Status int
+	// Whether the route is a page, which is written to an index.html file in
+	// the route's directory, rather than to a file at the route's path
+	IsPage bool
+}
+
+// Renders every route of the site into a directory, so that it can be hosted
+// on any static file host or CDN.
+func runExport(outDir string) error {
+	slog.Info("Exporting static site", "dir", outDir)
+
+	routes, err := collectExportRoutes()
+	if err != nil {
+		return err
+	}
+
+	handler := createHttpHandler()
+	for _, route := range routes {
+		if err := exportRouteToFile(handler, route, outDir); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Exported static site", "dir", outDir, slog.Int("num", len(routes)))
+	return nil
+}
+
+// Collects the routes to export, mirroring those registered in createHttpHandler.
+func collectExportRoutes() ([]exportRoute, error) {
+	routes := []exportRoute{
+		{"/", 200, true},
+		{"/404.html", 404, false},
+		{"/blog", 200, true},
+		{"/blog/tags", 200, true},
+		{"/projects/", 200, true},
+		{"/about", 200, true},
+		{"/robots.txt", 200, false},
+		{"/sitemap.xml", 200, false},
+	}
+
+	for _, format := range FeedFormats {
+		routes = append(routes, exportRoute{"/blog/feed." + format, 200, false})
+	}
+
+	total, err := blog.NumPublicPosts()
+	if err != nil {
+		return nil, err
+	}
+
+	numPages := int(math.Ceil(float64(total) / float64(NumPostsPerPage)))
+	for page := 1; page <= numPages; page++ {
+		routes = append(routes, exportRoute{"/blog/page/" + strconv.Itoa(page), 200, true})
+	}
+
+	tags, err := blog.GetTags()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range tags {
+		tagURL := "/blog/tag/" + tag.Tag
+		routes = append(routes, exportRoute{tagURL, 200, true})
+
+		numPages := int(math.Ceil(float64(tag.Count) / float64(NumPostsPerPage)))
+		for page := 1; page <= numPages; page++ {
+			routes = append(routes, exportRoute{tagURL + "/page/" + strconv.Itoa(page), 200, true})
+		}
+	}
+
+	posts, err := blog.GetPosts(total, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, post := range posts {
+		routes = append(routes, exportRoute{"/blog/" + post.Slug, 200, true})
+
+		bundleRoutes, err := collectBundleRoutes(post)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, bundleRoutes...)
+	}
+
+	sitemapURLs, err := collectSitemapURLs()
+	if err != nil {
+		return nil, err
+	}
+	if numPages := numSitemapPages(len(sitemapURLs)); numPages > 1 {
+		for page := 1; page <= numPages; page++ {
+			routes = append(routes, exportRoute{"/sitemaps/" + strconv.Itoa(page) + ".xml", 200, false})
+		}
+	}
+
+	// assets are exported under both their plain and fingerprinted names
+	err = fs.WalkDir(getFS(PublicDir), ".", func(filepath string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			routes = append(routes, exportRoute{"/assets/" + filepath, 200, false}, exportRoute{assets.URL(filepath), 200, false})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	allImages, err := images.All()
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range allImages {
+		for _, variantURL := range img.VariantURLs() {
+			routes = append(routes, exportRoute{variantURL, 200, false})
+		}
+	}
+
+	return routes, nil
+}
+
+// Collects the routes of the files in a post's bundle, if it has one.
+func collectBundleRoutes(post *blog.Post) ([]exportRoute, error) {
+	dir, err := blog.GetBundleDir(post.Slug)
+	if err != nil || dir == "" {
+		return nil, err
+	}
+
+	routes := []exportRoute{}
+	err = fs.WalkDir(getFS(path.Join(PostsDir, dir)), ".", func(filepath string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && path.Ext(filepath) != ".md" {
+			routes = append(routes, exportRoute{"/blog/" + post.Slug + "/" + filepath, 200, false})
+		}
+		return err
+	})
+	return routes, err
+}
+
+// Renders a single route through the HTTP handler and writes the response body
+// to the route's file in the output directory.
+func exportRouteToFile(handler http.Handler, route exportRoute, outDir string) error {
+	req := httptest.NewRequest(http.MethodGet, route.URL, nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != route.Status {
+		return fmt.Errorf("export: unexpected status %d for %s", rec.Code, route.URL)
+	}
+
+	outFile := filepath.Join(outDir, filepath.FromSlash(route.filePath()))
+	if err := os.MkdirAll(filepath.Dir(outFile), 0755); err != nil {
+		return err
+	}
+
+	slog.Debug("export: writing file", "url", route.URL, "file", outFile)
+	return os.WriteFile(outFile, rec.Body.Bytes(), 0644)
+}
+
+// The file path that a static host would serve the route from.
+func (route exportRoute) filePath() string {
+	if !route.IsPage {
+		return route.URL
+	}
+	return path.Join(route.URL, "index.html")
+}
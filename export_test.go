@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRouteFilePath(t *testing.T) {
+	routes := map[exportRoute]string{
+		{"/", 200, true}:                           "/index.html",
+		{"/blog/go-1.22-notes", 200, true}:         "/blog/go-1.22-notes/index.html",
+		{"/404.html", 404, false}:                  "/404.html",
+		{"/blog/feed.rss", 200, false}:             "/blog/feed.rss",
+		{"/blog/post/diagram", 200, false}:         "/blog/post/diagram",
+		{"/assets/style.1a2b3c4d.css", 200, false}: "/assets/style.1a2b3c4d.css",
+	}
+	for route, expected := range routes {
+		assert.Equal(t, expected, route.filePath(), route.URL)
+	}
+}
@@ -2,33 +2,72 @@ package main
 
 import (
 	"compress/gzip"
-	"io"
 	"net/http"
 	"strings"
 )
 
 func gzipHandler(handler http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
 		accept := req.Header.Get("Accept-Encoding")
-		if strings.Contains(accept, "gzip") {
-			w.Header().Set("Content-Encoding", "gzip")
-			gw := gzip.NewWriter(w)
-			defer gw.Close()
-			w = GzipResponseWriter{ResponseWriter: w, Writer: gw}
+		if !strings.Contains(accept, "gzip") {
+			handler.ServeHTTP(w, req)
+			return
 		}
 
-		handler.ServeHTTP(w, req)
+		gw := &GzipResponseWriter{ResponseWriter: w, isHead: req.Method == http.MethodHead}
+		defer gw.Close()
+		handler.ServeHTTP(gw, req)
 	}
 }
 
+// Compresses a response with gzip, unless the response has no body.
 type GzipResponseWriter struct {
-	io.Writer
 	http.ResponseWriter
+	// The compressing writer, or nil if the response is not compressed
+	gzipWriter *gzip.Writer
+	// Whether the response is to a HEAD request, which has the headers of a
+	// compressed response but no body
+	isHead      bool
+	wroteHeader bool
+}
+
+func (gw *GzipResponseWriter) WriteHeader(status int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+
+	hasBody := status != http.StatusNotModified && status != http.StatusNoContent
+	if hasBody && gw.Header().Get("Content-Encoding") == "" {
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.Header().Del("Content-Length")
+		if !gw.isHead {
+			gw.gzipWriter = gzip.NewWriter(gw.ResponseWriter)
+		}
+	}
+
+	gw.ResponseWriter.WriteHeader(status)
 }
 
-func (gw GzipResponseWriter) Write(b []byte) (int, error) {
+func (gw *GzipResponseWriter) Write(b []byte) (int, error) {
 	if gw.Header().Get("Content-Type") == "" {
 		gw.Header().Set("Content-Type", http.DetectContentType(b))
 	}
-	return gw.Writer.Write(b)
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	if gw.gzipWriter == nil {
+		return gw.ResponseWriter.Write(b)
+	}
+	return gw.gzipWriter.Write(b)
+}
+
+func (gw *GzipResponseWriter) Close() error {
+	if gw.gzipWriter == nil {
+		return nil
+	}
+	return gw.gzipWriter.Close()
 }
@@ -0,0 +1,211 @@
+package images
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The file system that image assets are read from, set by main.
+var FS fs.FS
+
+// The URL path prefix that image assets are served under.
+const URLPrefix = "/assets/"
+
+// The widths of the resized variants of an image, in pixels. Only widths that
+// are smaller than the original image are generated.
+var Widths = []int{480, 960, 1440}
+
+// The sizes attribute of responsive images, matching the width of the main
+// layout in style.css.
+const Sizes = "(max-width: 960px) 100vw, 960px"
+
+// A JPEG or PNG image asset
+type Image struct {
+	// The path of the image in FS
+	Path   string
+	Format string
+	Width  int
+	Height int
+}
+
+// A URL to an image variant, with the width of that variant
+type Candidate struct {
+	URL   string
+	Width int
+}
+
+var (
+	mutex     sync.Mutex
+	infoCache = map[string]*Image{}
+)
+
+// Looks up an image asset by its URL, such as "/assets/avatar.jpg". The second
+// return value is false if the URL does not refer to a JPEG or PNG asset.
+func Lookup(url string) (*Image, bool) {
+	if FS == nil || !strings.HasPrefix(url, URLPrefix) {
+		return nil, false
+	}
+	filepath := strings.TrimPrefix(url, URLPrefix)
+	if !isSourceFile(filepath) {
+		return nil, false
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if img, isCached := infoCache[filepath]; isCached {
+		return img, img != nil
+	}
+
+	img, err := readImageInfo(filepath)
+	if err != nil {
+		img = nil
+	}
+	infoCache[filepath] = img
+	return img, img != nil
+}
+
+// Clears the cached info and variants of all images.
+func ClearCache() {
+	mutex.Lock()
+	clear(infoCache)
+	mutex.Unlock()
+
+	variantMutex.Lock()
+	defer variantMutex.Unlock()
+	clear(variantCache)
+}
+
+func readImageInfo(filepath string) (*Image, error) {
+	file, err := FS.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{filepath, format, config.Width, config.Height}, nil
+}
+
+// The URL of the original image
+func (img *Image) URL() string {
+	return URLPrefix + img.Path
+}
+
+// The widths of the image's resized variants, smallest first.
+func (img *Image) Widths() []int {
+	widths := []int{}
+	for _, width := range Widths {
+		if width < img.Width {
+			widths = append(widths, width)
+		}
+	}
+	slices.Sort(widths)
+	return widths
+}
+
+// The resized variants of the image in its own format, followed by the
+// original image.
+func (img *Image) Candidates() []Candidate {
+	candidates := []Candidate{}
+	for _, width := range img.Widths() {
+		candidates = append(candidates, Candidate{URLPrefix + resizedPath(img.Path, width), width})
+	}
+	return append(candidates, Candidate{img.URL(), img.Width})
+}
+
+// Whether WebP versions of the image are offered. JPEG images get lossy WebP
+// versions and PNG images get lossless ones.
+func (img *Image) HasWebP() bool {
+	return img.Format == "jpeg" || img.Format == "png"
+}
+
+// The WebP versions of the image's candidates, or nil if it has no WebP versions.
+func (img *Image) WebPCandidates() []Candidate {
+	if !img.HasWebP() {
+		return nil
+	}
+	candidates := img.Candidates()
+	for i := range candidates {
+		candidates[i].URL += ".webp"
+	}
+	return candidates
+}
+
+// Formats candidates as the value of a srcset attribute.
+func Srcset(candidates []Candidate) string {
+	parts := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		parts[i] = fmt.Sprintf("%s %dw", candidate.URL, candidate.Width)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// The URLs of all the generated variants of the image, excluding the original.
+func (img *Image) VariantURLs() []string {
+	urls := []string{}
+	for _, candidate := range img.Candidates() {
+		if candidate.URL != img.URL() {
+			urls = append(urls, candidate.URL)
+		}
+	}
+	for _, candidate := range img.WebPCandidates() {
+		urls = append(urls, candidate.URL)
+	}
+	return urls
+}
+
+// Lists the JPEG and PNG images in FS.
+func All() ([]*Image, error) {
+	if FS == nil {
+		return nil, nil
+	}
+
+	all := []*Image{}
+	err := fs.WalkDir(FS, ".", func(filepath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !isSourceFile(filepath) {
+			return err
+		}
+		if img, ok := Lookup(URLPrefix + filepath); ok {
+			all = append(all, img)
+		}
+		return nil
+	})
+	return all, err
+}
+
+// Hashes the paths and dimensions of all images in FS. The hash changes
+// whenever the markup that is rendered for the images could change.
+func Fingerprint() (string, error) {
+	all, err := All()
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, img := range all {
+		fmt.Fprintf(hash, "%s %s %dx%d\n", img.Path, img.Format, img.Width, img.Height)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+func isSourceFile(filepath string) bool {
+	switch strings.ToLower(path.Ext(filepath)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	default:
+		return false
+	}
+}
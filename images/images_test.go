@@ -0,0 +1,109 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/chai2010/webp"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestFS(t *testing.T) {
+	photo, logo := bytes.Buffer{}, bytes.Buffer{}
+	assert.Nil(t, jpeg.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 1000, 500)), nil))
+	assert.Nil(t, png.Encode(&logo, image.NewRGBA(image.Rect(0, 0, 600, 600))))
+
+	FS = fstest.MapFS{
+		"photo.jpg":     {Data: photo.Bytes()},
+		"img/logo.png":  {Data: logo.Bytes()},
+		"style.css":     {Data: []byte("body {}")},
+		"broken.png":    {Data: []byte("not a png")},
+		"photo.480w.js": {Data: []byte("")},
+	}
+	t.Cleanup(func() {
+		FS = nil
+		ClearCache()
+	})
+}
+
+func TestLookup(t *testing.T) {
+	setupTestFS(t)
+
+	img, ok := Lookup("/assets/photo.jpg")
+	assert.True(t, ok)
+	assert.Equal(t, &Image{"photo.jpg", "jpeg", 1000, 500}, img)
+	assert.Equal(t, "/assets/photo.480w.jpg 480w, /assets/photo.960w.jpg 960w, /assets/photo.jpg 1000w", Srcset(img.Candidates()))
+	assert.True(t, img.HasWebP(), "jpeg images should have lossy webp versions")
+	assert.Equal(t, "/assets/photo.480w.jpg.webp 480w, /assets/photo.960w.jpg.webp 960w, /assets/photo.jpg.webp 1000w", Srcset(img.WebPCandidates()))
+
+	img, ok = Lookup("/assets/img/logo.png")
+	assert.True(t, ok)
+	assert.Equal(t, "/assets/img/logo.480w.png.webp 480w, /assets/img/logo.png.webp 600w", Srcset(img.WebPCandidates()))
+	assert.Equal(t, []string{"/assets/img/logo.480w.png", "/assets/img/logo.480w.png.webp", "/assets/img/logo.png.webp"}, img.VariantURLs())
+
+	for _, url := range []string{"/assets/style.css", "/assets/broken.png", "/assets/missing.jpg", "/blog/photo.jpg", "https://example.com/a.png"} {
+		_, ok = Lookup(url)
+		assert.False(t, ok, "should not find image for %s", url)
+	}
+}
+
+func TestParseVariantPath(t *testing.T) {
+	source, width, isWebP, ok := parseVariantPath("a/b.480w.png.webp")
+	assert.True(t, ok)
+	assert.Equal(t, "a/b.png", source)
+	assert.Equal(t, 480, width)
+	assert.True(t, isWebP)
+
+	source, width, isWebP, ok = parseVariantPath("b.960w.jpg")
+	assert.True(t, ok)
+	assert.Equal(t, "b.jpg", source)
+	assert.Equal(t, 960, width)
+	assert.False(t, isWebP)
+
+	_, _, _, ok = parseVariantPath("b.jpg")
+	assert.False(t, ok, "originals should not be variants")
+	_, _, _, ok = parseVariantPath("b.480w.css")
+	assert.False(t, ok, "only images should have variants")
+}
+
+func TestHandler(t *testing.T) {
+	setupTestFS(t)
+	handler := Handler(http.FileServer(http.FS(FS)))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := serve("/photo.480w.jpg")
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "image/jpeg", rec.Header().Get("Content-Type"))
+	config, err := jpeg.DecodeConfig(rec.Body)
+	assert.Nil(t, err, "should serve a valid jpeg")
+	assert.Equal(t, 480, config.Width)
+	assert.Equal(t, 240, config.Height)
+
+	rec = serve("/img/logo.480w.png.webp")
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "image/webp", rec.Header().Get("Content-Type"))
+
+	rec = serve("/photo.960w.jpg.webp")
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "image/webp", rec.Header().Get("Content-Type"))
+	config, err = webp.DecodeConfig(rec.Body)
+	assert.Nil(t, err, "should serve a valid webp")
+	assert.Equal(t, 960, config.Width)
+	assert.Equal(t, 480, config.Height)
+
+	assert.Equal(t, 200, serve("/style.css").Code, "should serve other files")
+	assert.Equal(t, 404, serve("/style.css.webp").Code, "should only offer webp for images")
+	assert.Equal(t, 404, serve("/photo.123w.jpg").Code, "should only offer listed widths")
+	assert.Equal(t, 404, serve("/img/logo.960w.png").Code, "should not upscale")
+}
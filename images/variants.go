@@ -0,0 +1,167 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+)
+
+// The quality of resized JPEG variants
+const JPEGQuality = 82
+
+// The quality of the lossy WebP versions of JPEG images
+const WebPQuality = 80
+
+// Matches the width suffix of a resized variant's path, such as ".480w" in
+// "avatar.480w.jpg", capturing the width.
+var resizedSuffixRegex = regexp.MustCompile(`\.(\d+)w$`)
+
+// A generated image variant
+type variant struct {
+	data        []byte
+	contentType string
+}
+
+var (
+	variantMutex sync.Mutex
+	variantCache = map[string]*variant{}
+)
+
+// The path of an image's variant that is resized to a width. The variant of
+// "avatar.jpg" at 480 pixels wide is "avatar.480w.jpg".
+func resizedPath(filepath string, width int) string {
+	ext := path.Ext(filepath)
+	return strings.TrimSuffix(filepath, ext) + "." + strconv.Itoa(width) + "w" + ext
+}
+
+// Parses the path of a variant into the path of its source image, the width
+// that it is resized to (or 0 for the original size), and whether it is a WebP
+// version. WebP versions append ".webp" to the path of the variant that they
+// are converted from, as in "logo.png.webp" and "logo.480w.png.webp".
+func parseVariantPath(filepath string) (source string, width int, isWebP bool, ok bool) {
+	source, isWebP = strings.CutSuffix(filepath, ".webp")
+	if !isSourceFile(source) {
+		return "", 0, false, false
+	}
+
+	ext := path.Ext(source)
+	name := strings.TrimSuffix(source, ext)
+	if match := resizedSuffixRegex.FindStringSubmatch(name); match != nil {
+		width, _ = strconv.Atoi(match[1])
+		source = strings.TrimSuffix(name, match[0]) + ext
+	}
+
+	// the original is served by the file server, not as a variant
+	if width == 0 && !isWebP {
+		return "", 0, false, false
+	}
+	return source, width, isWebP, true
+}
+
+// Returns a variant of an image by its path in FS, generating it on first use.
+// The error is fs.ErrNotExist if the path is not a variant that is offered for
+// an existing image.
+func getVariant(filepath string) (*variant, error) {
+	source, width, isWebP, ok := parseVariantPath(filepath)
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	img, exists := Lookup(URLPrefix + source)
+	if !exists || (isWebP && !img.HasWebP()) || (width != 0 && !slices.Contains(img.Widths(), width)) {
+		return nil, fs.ErrNotExist
+	}
+
+	variantMutex.Lock()
+	defer variantMutex.Unlock()
+
+	if cached, isCached := variantCache[filepath]; isCached {
+		return cached, nil
+	}
+
+	generated, err := generateVariant(img, width, isWebP)
+	if err != nil {
+		return nil, err
+	}
+	variantCache[filepath] = generated
+	return generated, nil
+}
+
+func generateVariant(img *Image, width int, isWebP bool) (*variant, error) {
+	file, err := FS.Open(img.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoded, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if width != 0 {
+		decoded = resize(decoded, width)
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case isWebP:
+		// photos are compressed lossily like their originals, while graphics
+		// keep their exact pixels
+		err = webp.Encode(&buf, decoded, &webp.Options{Lossless: img.Format == "png", Quality: WebPQuality})
+		return &variant{buf.Bytes(), "image/webp"}, err
+	case img.Format == "jpeg":
+		err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: JPEGQuality})
+		return &variant{buf.Bytes(), "image/jpeg"}, err
+	case img.Format == "png":
+		err = png.Encode(&buf, decoded)
+		return &variant{buf.Bytes(), "image/png"}, err
+	default:
+		return nil, errors.New("images: unsupported format " + img.Format)
+	}
+}
+
+// Scales an image to a width, keeping its aspect ratio.
+func resize(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	height := max(1, (bounds.Dy()*width+bounds.Dx()/2)/bounds.Dx())
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// Wraps a file server of FS to also serve the variants of its images.
+// Requests for anything else are passed on to the file server.
+func Handler(fileServer http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		generated, err := getVariant(strings.TrimPrefix(r.URL.Path, "/"))
+		if errors.Is(err, fs.ErrNotExist) {
+			fileServer.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			slog.Error("error generating image variant", slog.String("path", r.URL.Path), slog.String("cause", err.Error()))
+			w.WriteHeader(500)
+			return
+		}
+
+		w.Header().Set("Content-Type", generated.contentType)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(generated.data))
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The URL path of the server-sent events stream that tells pages to reload.
+// It is only served in dev mode.
+const LiveReloadPath = "/__livereload"
+
+// The live reload events. Pages reload on LiveReloadPage, and replace a
+// stylesheet on LiveReloadCSS, whose data is a JSON object with the "name" of
+// the stylesheet's asset and its new "url".
+const (
+	LiveReloadPage = "reload"
+	LiveReloadCSS  = "css"
+)
+
+// Sends live reload events to the connected pages.
+type LiveReloadHub struct {
+	mutex   sync.Mutex
+	clients map[chan liveReloadEvent]bool
+	closed  bool
+}
+
+type liveReloadEvent struct {
+	Name string
+	Data string
+}
+
+var liveReload = &LiveReloadHub{clients: map[chan liveReloadEvent]bool{}}
+
+// Checks whether the server runs in dev mode, where files are read from disk
+// and watched for changes.
+func isDevMode() bool {
+	return Flags.NoEmbed && Flags.Watch && flag.Arg(0) == ""
+}
+
+// Sends an event to all connected pages.
+func (hub *LiveReloadHub) Publish(name, data string) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	slog.Debug("livereload: publishing event", "event", name, "data", data, slog.Int("clients", len(hub.clients)))
+	for client := range hub.clients {
+		// a client that is behind only needs to reload once
+		select {
+		case client <- liveReloadEvent{name, data}:
+		default:
+		}
+	}
+}
+
+// Disconnects all pages, so that the server can shut down.
+func (hub *LiveReloadHub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for client := range hub.clients {
+		close(client)
+		delete(hub.clients, client)
+	}
+	hub.closed = true
+}
+
+// Streams the live reload events to a page until it disconnects.
+func (hub *LiveReloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	client := make(chan liveReloadEvent, 1)
+	hub.mutex.Lock()
+	if hub.closed {
+		hub.mutex.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	hub.clients[client] = true
+	hub.mutex.Unlock()
+
+	defer func() {
+		hub.mutex.Lock()
+		delete(hub.clients, client)
+		hub.mutex.Unlock()
+	}()
+
+	// the stream outlives the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(200)
+	rc.Flush()
+
+	for {
+		select {
+		case event, ok := <-client:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, event.Data)
+			rc.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -1,27 +1,39 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/mecha/mecha.dev/assets"
 	"github.com/mecha/mecha.dev/blog"
+	"github.com/mecha/mecha.dev/images"
 	"github.com/mecha/mecha.dev/md"
 	"github.com/mecha/mecha.dev/projects"
+	"github.com/mecha/mecha.dev/site"
 	"github.com/mecha/mecha.dev/views"
 )
 
 var (
 	Flags   = FlagsObj{}
 	Version = "dev"
+	// The time that the process started
+	startTime = time.Now()
 	//go:embed embed
 	embedFS embed.FS
 )
@@ -32,12 +44,31 @@ type FlagsObj struct {
 	Watch   bool
 	PortNum int
 	NoEmbed bool
+
+	Config    string
+	DBPath    string
+	BaseURL   string
+	FullFeeds bool
+
+	PreviewSecret string
+
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
 }
 
 const (
-	PostsDir     = "embed/content/posts"
-	ProjectsDir  = "embed/content/projects"
-	TemplatesDir = "embed/templates"
+	PostsDir       = "embed/content/posts"
+	ProjectsDir    = "embed/content/projects"
+	TemplatesDir   = "embed/templates"
+	PublicDir      = "embed/public"
+	SiteConfigFile = "embed/site.json"
+
+	DefaultExportDir  = "dist"
+	DefaultPreviewTTL = 7 * 24 * time.Hour
+
+	PreviewSecretEnv = "MECHA_PREVIEW_SECRET"
 )
 
 func main() {
@@ -51,10 +82,45 @@ func main() {
 		slog.SetLogLoggerLevel(slog.LevelInfo.Level())
 	}
 
-	if err := blog.InitDB(); err != nil {
+	config, err := loadSiteConfig()
+	if err != nil {
+		slog.Error("failed to load site config", slog.String("cause", err.Error()))
+		os.Exit(1)
+	}
+	site.Current = config
+
+	// assets must be available before content is rendered
+	assets.FS = getFS(PublicDir)
+	images.FS = assets.FS
+
+	// content is checked before it is loaded, since loading fails on the
+	// first invalid file
+	if flag.Arg(0) == "check" {
+		numProblems, err := runCheck()
+		if err != nil {
+			slog.Error("failed to check content", slog.String("cause", err.Error()))
+			os.Exit(1)
+		}
+		if numProblems > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if Flags.DBPath != "" {
+		err = blog.InitDBFile(Flags.DBPath)
+	} else {
+		err = blog.InitDB()
+	}
+	if err != nil {
 		slog.Error("failed to initialize blog", slog.String("cause", err.Error()))
 		os.Exit(1)
 	}
+	// the git history on disk only describes the posts that are read from disk
+	if Flags.NoEmbed {
+		blog.SourceDir = PostsDir
+	}
+	blog.RenderKey = renderKey()
 	if _, err := blog.LoadFromFs(getFS(PostsDir)); err != nil {
 		slog.Error("failed to load blog posts", slog.String("cause", err.Error()))
 		os.Exit(1)
@@ -65,21 +131,74 @@ func main() {
 		os.Exit(1)
 	}
 
-	if Flags.NoEmbed && Flags.Watch {
-		startPostFileWatcher()
-		startProjectFileWatcher()
-		startViewTemplateFileWatcher()
+	watchers := []*DirWatcher{}
+	if isDevMode() {
+		watchers = append(watchers,
+			startPostFileWatcher(),
+			startProjectFileWatcher(),
+			startViewTemplateFileWatcher(),
+			startPublicFileWatcher(),
+		)
 	}
 
 	views.TemplateFS = getFS(TemplatesDir)
-	go runHttpServer()
+	views.DevMode = isDevMode()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "export":
+		outDir := flag.Arg(1)
+		if outDir == "" {
+			outDir = DefaultExportDir
+		}
+		if err := runExport(outDir); err != nil {
+			slog.Error("failed to export site", slog.String("cause", err.Error()))
+			os.Exit(1)
+		}
+		return
+	case "preview":
+		if err := runPreview(flag.Arg(1), flag.Arg(2)); err != nil {
+			slog.Error("failed to create preview link", slog.String("cause", err.Error()))
+			os.Exit(1)
+		}
+		return
+	default:
+		slog.Error("unknown command", slog.String("command", cmd))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	server := newHttpServer()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- runHttpServer(server)
+	}()
 
 	intSig := make(chan os.Signal, 1)
 	signal.Notify(intSig, os.Interrupt, syscall.SIGTERM)
-	<-intSig
+
+	exitCode := 0
+	select {
+	case <-intSig:
+	case err := <-serverErr:
+		slog.Error("unexpected server error", slog.String("cause", err.Error()))
+		exitCode = 1
+	}
 
 	slog.Info("Shutting down...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), Flags.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("failed to drain http connections", slog.String("cause", err.Error()))
+	}
+
+	for _, watcher := range watchers {
+		watcher.Stop()
+	}
+
 	blog.DestroyDB()
+	os.Exit(exitCode)
 }
 
 func parseFlags() {
@@ -87,6 +206,12 @@ func parseFlags() {
 		fmt.Println("mecha.dev server")
 		fmt.Println("https://github.com/mecha/mecha.dev")
 		fmt.Println()
+		fmt.Println("USAGE:")
+		fmt.Println("  mecha.dev [flags]\t\t\tStart the HTTP server")
+		fmt.Println("  mecha.dev [flags] export [dir]\tRender the site to a directory. Default: " + DefaultExportDir)
+		fmt.Println("  mecha.dev [flags] check\t\tCheck the content files for problems")
+		fmt.Println("  mecha.dev [flags] preview <slug> [ttl]\tPrint a signed preview link for a draft post. Default ttl: " + DefaultPreviewTTL.String())
+		fmt.Println()
 		fmt.Println("FLAGS:")
 		fmt.Println("  -h, --help\tShow this help message")
 		flag.VisitAll(func(f *flag.Flag) {
@@ -96,10 +221,89 @@ func parseFlags() {
 	Flags = FlagsObj{}
 	flag.BoolVar(&Flags.Verbose, "verbose", false, "Enables debug logging.")
 	flag.BoolVar(&Flags.Quiet, "quiet", false, "Disables all non-error logging.")
-	flag.BoolVar(&Flags.Watch, "watch", false, "Watch blog post and view template files for changes.")
+	flag.BoolVar(&Flags.Watch, "watch", false, "Watch content, template and asset files for changes, and reload pages in the browser. Requires -noembed.")
 	flag.IntVar(&Flags.PortNum, "port", 8080, "The HTTP port to serve through.")
 	flag.BoolVar(&Flags.NoEmbed, "noembed", false, "Reads files from the OS filesystem instead of the embedded filesystem.")
+	flag.StringVar(&Flags.Config, "config", "", "Path to a site config file. Uses the embedded "+SiteConfigFile+" if empty.")
+	flag.StringVar(&Flags.DBPath, "db", "", "Path to a persistent sqlite database file. Uses an in-memory database if empty.")
+	flag.StringVar(&Flags.BaseURL, "baseurl", "", "Overrides the absolute URL of the site from the site config.")
+	flag.BoolVar(&Flags.FullFeeds, "fullfeeds", false, "Include full post content in feeds by default, instead of excerpts.")
+	flag.DurationVar(&Flags.ReadTimeout, "read-timeout", 10*time.Second, "The maximum duration for reading an entire HTTP request.")
+	flag.DurationVar(&Flags.WriteTimeout, "write-timeout", 30*time.Second, "The maximum duration before timing out writes of an HTTP response.")
+	flag.DurationVar(&Flags.IdleTimeout, "idle-timeout", 2*time.Minute, "The maximum time to wait for the next request on keep-alive connections.")
+	flag.DurationVar(&Flags.ShutdownTimeout, "shutdown-timeout", 15*time.Second, "The maximum time to wait for in-flight requests to finish when shutting down.")
+	flag.StringVar(&Flags.PreviewSecret, "preview-secret", "", "The secret used to sign draft preview links. Uses $"+PreviewSecretEnv+" if empty.")
 	flag.Parse()
+
+	if Flags.PreviewSecret == "" {
+		Flags.PreviewSecret = os.Getenv(PreviewSecretEnv)
+	}
+}
+
+// Derives the key that identifies how posts are rendered, from the build version
+// and the dimensions of the image assets. Builds without a version may have
+// any rendering code, so their key changes on every start.
+func renderKey() string {
+	version := Version
+	if version == "dev" {
+		version += "-" + strconv.FormatInt(startTime.UnixNano(), 36)
+	}
+
+	fingerprint, err := images.Fingerprint()
+	if err != nil {
+		slog.Error("main: failed to fingerprint images", slog.String("cause", err.Error()))
+	}
+	return version + ":" + fingerprint
+}
+
+// Prints a signed link that previews a post before it is published.
+func runPreview(slug, ttlStr string) error {
+	if slug == "" {
+		return errors.New("missing post slug")
+	}
+
+	ttl := DefaultPreviewTTL
+	if ttlStr != "" {
+		var err error
+		if ttl, err = time.ParseDuration(ttlStr); err != nil {
+			return err
+		}
+	}
+
+	if _, err := blog.GetPostBySlug(slug); err != nil {
+		return fmt.Errorf("post %q: %w", slug, err)
+	}
+
+	token, err := blog.NewPreviewToken(slug, time.Now().Add(ttl), []byte(Flags.PreviewSecret))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(site.Current.URL("/blog/" + slug + "?preview=" + url.QueryEscape(token)))
+	return nil
+}
+
+// Loads the site config file and applies overrides from the flags.
+func loadSiteConfig() (*site.Config, error) {
+	var config *site.Config
+	var err error
+	if Flags.Config != "" {
+		config, err = site.ParseFile(os.DirFS(filepath.Dir(Flags.Config)), filepath.Base(Flags.Config))
+	} else {
+		config, err = site.ParseFile(getFS(path.Dir(SiteConfigFile)), path.Base(SiteConfigFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if Flags.BaseURL != "" {
+		config.BaseURL = strings.TrimSuffix(Flags.BaseURL, "/")
+	}
+	if Flags.FullFeeds {
+		config.Feed.FullContent = true
+	}
+
+	return config, nil
 }
 
 func getFS(path string) fs.FS {
@@ -114,42 +318,47 @@ func getFS(path string) fs.FS {
 	}
 }
 
-func startPostFileWatcher() {
+func startPostFileWatcher() *DirWatcher {
 	slog.Debug("main: starting blog post file watcher")
-	fsys := os.DirFS(".")
+	fsys := os.DirFS(PostsDir)
 
-	postWatcher := NewDirWatcher(PostsDir, func(event fsnotify.Event) {
+	// bundles are subdirectories, so the watcher is recursive
+	postWatcher := NewRecursiveDirWatcher(PostsDir, func(event fsnotify.Event) {
 		filename := event.Name
-		slug := blog.SlugFromFilePath(filename)
-		slogSlugAttr := slog.String("slug", slug)
 		slogFileAttr := slog.String("file", filename)
 
-		if strings.HasSuffix(filename, "~") {
+		relPath, err := filepath.Rel(PostsDir, filename)
+		if err != nil {
+			slog.Error("main: blog post file is outside the posts directory", slogFileAttr)
 			return
 		}
+		relPath = filepath.ToSlash(relPath)
+
+		defer liveReload.Publish(LiveReloadPage, "")
 
 		if event.Has(fsnotify.Remove | fsnotify.Rename) {
 			slog.Debug("main: removing blog post", slogFileAttr)
 
-			_, err := blog.DeletePost(slug)
-			if err != nil {
-				slog.Error("failed to delete blog post", slogSlugAttr, slogFileAttr)
-				return
+			// the removed path may be a bundle's directory
+			for _, postPath := range []string{relPath, path.Join(relPath, blog.BundleIndexFile)} {
+				if _, err := blog.UnloadPostFile(postPath); err != nil {
+					slog.Error("failed to delete blog post", slogFileAttr, slog.String("cause", err.Error()))
+					return
+				}
 			}
 		}
 
+		// the other files in bundles are served as they are
+		if !blog.IsPostFile(relPath) {
+			return
+		}
+
 		if event.Has(fsnotify.Create | fsnotify.Write) {
 			slog.Debug("main: loading blog post", slogFileAttr)
 
-			post, err := blog.ParsePostFile(fsys, filename)
-			if err != nil {
-				slog.Error("failed to parse blog post file", slogFileAttr, slog.String("cause", err.Error()))
-				return
-			}
-
-			err = blog.InsertPost(post)
+			_, _, err := blog.LoadPostFile(fsys, relPath)
 			if err != nil {
-				slog.Error("failed to insert/update blog post", slogFileAttr, slog.String("cause", err.Error()))
+				slog.Error("failed to load blog post file", slogFileAttr, slog.String("cause", err.Error()))
 				return
 			}
 		}
@@ -159,9 +368,11 @@ func startPostFileWatcher() {
 	if err != nil {
 		slog.Error("main: failed to start post file watcher", slog.String("cause", err.Error()))
 	}
+
+	return postWatcher
 }
 
-func startProjectFileWatcher() {
+func startProjectFileWatcher() *DirWatcher {
 	slog.Debug("main: starting project file watcher")
 	fsys := os.DirFS(".")
 
@@ -171,9 +382,7 @@ func startProjectFileWatcher() {
 		slogIdAttr := slog.String("id", projId)
 		slogFileAttr := slog.String("file", filename)
 
-		if strings.HasSuffix(filename, "~") {
-			return
-		}
+		defer liveReload.Publish(LiveReloadPage, "")
 
 		if event.Has(fsnotify.Remove | fsnotify.Rename) {
 			slog.Debug("main: removing project", slogIdAttr, slogFileAttr)
@@ -195,15 +404,18 @@ func startProjectFileWatcher() {
 	if err != nil {
 		slog.Error("main: failed to start projects markdown file watcher", slog.String("cause", err.Error()))
 	}
+
+	return mdWatcher
 }
 
-func startViewTemplateFileWatcher() {
+func startViewTemplateFileWatcher() *DirWatcher {
 	slog.Debug("main: starting view template file watcher")
 	tmplWatcher := NewDirWatcher(TemplatesDir, func(event fsnotify.Event) {
 		if event.Has(fsnotify.Write) {
 			tmplFile := path.Base(event.Name)
 			slog.Debug("main: invalidating cached view template", "file", tmplFile)
 			views.ClearCache(tmplFile)
+			liveReload.Publish(LiveReloadPage, "")
 		}
 	})
 
@@ -211,4 +423,45 @@ func startViewTemplateFileWatcher() {
 	if err != nil {
 		slog.Error("main: failed to start view template file watcher", slog.String("cause", err.Error()))
 	}
+
+	return tmplWatcher
+}
+
+func startPublicFileWatcher() *DirWatcher {
+	slog.Debug("main: starting public asset file watcher")
+	publicWatcher := NewRecursiveDirWatcher(PublicDir, func(event fsnotify.Event) {
+		relPath, err := filepath.Rel(PublicDir, event.Name)
+		if err != nil {
+			slog.Error("main: asset file is outside the public directory", slog.String("file", event.Name))
+			return
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		slog.Debug("main: invalidating cached asset fingerprint and images", "file", relPath)
+		assets.ClearCache(relPath)
+		images.ClearCache()
+
+		// posts are rendered with the dimensions of their images
+		if key := renderKey(); key != blog.RenderKey {
+			blog.RenderKey = key
+			if _, err := blog.LoadFromFs(getFS(PostsDir)); err != nil {
+				slog.Error("main: failed to render blog posts again", slog.String("cause", err.Error()))
+			}
+		}
+
+		// stylesheets can be replaced without reloading the page
+		if path.Ext(relPath) == ".css" && event.Has(fsnotify.Write) {
+			data, _ := json.Marshal(map[string]string{"name": relPath, "url": assets.URL(relPath)})
+			liveReload.Publish(LiveReloadCSS, string(data))
+		} else {
+			liveReload.Publish(LiveReloadPage, "")
+		}
+	})
+
+	err := publicWatcher.Start()
+	if err != nil {
+		slog.Error("main: failed to start public asset file watcher", slog.String("cause", err.Error()))
+	}
+
+	return publicWatcher
 }
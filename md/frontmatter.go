@@ -0,0 +1,334 @@
+package md
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Front matter formats
+const (
+	// YAML front matter, fenced by "---" lines
+	FormatYAML = "yaml"
+	// TOML front matter, fenced by "+++" lines
+	FormatTOML = "toml"
+	// Bare "key: value" lines at the start of the document, ended by a "---" line
+	FormatBare = "bare"
+)
+
+// The front matter of a markdown document.
+type FrontMatter struct {
+	// The format that the front matter was written in
+	Format string
+	// The front matter data as a YAML mapping, regardless of the format
+	node *yaml.Node
+}
+
+// A top-level key in a document's front matter.
+type Key struct {
+	Name string
+	// The line number of the key in the document, starting at 1
+	Line int
+}
+
+// An error in a document's front matter.
+type FrontMatterError struct {
+	// The line number of the error in the document, starting at 1
+	Line int
+	Err  error
+}
+
+func (e *FrontMatterError) Error() string {
+	return fmt.Sprintf("front matter line %d: %s", e.Line, e.Err.Error())
+}
+
+func (e *FrontMatterError) Unwrap() error {
+	return e.Err
+}
+
+// A list of strings in front matter, which can be written either as a list or
+// as a comma-separated string.
+type List []string
+
+func (l *List) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = nil
+		for _, item := range strings.Split(node.Value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*l = append(*l, item)
+			}
+		}
+		return nil
+	}
+
+	var items []string
+	if err := node.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// Decodes the front matter into a struct, using the struct's yaml field tags
+// for all formats. Keys in the front matter that do not map to a field in the
+// struct are ignored; see UnknownKeys.
+func (fm *FrontMatter) Decode(v any) error {
+	// each key is decoded on its own so that every error can be attributed to
+	// a line, since some decoding errors do not carry a position
+	errs := []error{}
+	for i := 0; i+1 < len(fm.node.Content); i += 2 {
+		keyNode, valueNode := fm.node.Content[i], fm.node.Content[i+1]
+		pair := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{keyNode, valueNode}}
+
+		err := pair.Decode(v)
+
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, msg := range typeErr.Errors {
+				errs = append(errs, yamlErrorToFrontMatterError(msg, keyNode.Line))
+			}
+		} else if err != nil {
+			errs = append(errs, &FrontMatterError{keyNode.Line, fmt.Errorf("%s: %w", keyNode.Value, err)})
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Returns the top-level keys in the front matter, in document order.
+func (fm *FrontMatter) Keys() []Key {
+	keys := make([]Key, 0, len(fm.node.Content)/2)
+	for i := 0; i < len(fm.node.Content); i += 2 {
+		keyNode := fm.node.Content[i]
+		keys = append(keys, Key{keyNode.Value, keyNode.Line})
+	}
+	return keys
+}
+
+// Returns the top-level keys in the front matter that do not map to any of the
+// fields of a struct when decoding.
+func (fm *FrontMatter) UnknownKeys(v any) []Key {
+	known := map[string]bool{}
+
+	typ := reflect.TypeOf(v)
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		known[name] = true
+	}
+
+	unknown := []Key{}
+	for _, key := range fm.Keys() {
+		if !known[key.Name] {
+			unknown = append(unknown, key)
+		}
+	}
+	return unknown
+}
+
+// Parses the front matter at the start of a list of lines. Returns the front
+// matter and the index of the first line of the document's body.
+func parseFrontMatter(lines []string) (*FrontMatter, int, error) {
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+
+	if start == len(lines) {
+		return newFrontMatter(FormatBare, nil), start, nil
+	}
+
+	switch strings.TrimSpace(lines[start]) {
+	case "---":
+		// a "---" line also ends an empty bare header, so it only starts YAML
+		// front matter if it is closed and encloses a mapping
+		end, err := findClosingFence(lines, start, "---")
+		if err != nil {
+			return parseBareFrontMatter(lines, start)
+		}
+		fm, err := parseYAMLFrontMatter(lines, start, end)
+		if err != nil && !startsWithYAMLKey(lines, start, end) {
+			return parseBareFrontMatter(lines, start)
+		}
+		return fm, end + 1, err
+
+	case "+++":
+		end, err := findClosingFence(lines, start, "+++")
+		if err != nil {
+			return nil, 0, err
+		}
+		fm, err := parseTOMLFrontMatter(lines, start, end)
+		return fm, end + 1, err
+
+	default:
+		return parseBareFrontMatter(lines, start)
+	}
+}
+
+func findClosingFence(lines []string, start int, fence string) (int, error) {
+	for i := start + 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == fence {
+			return i, nil
+		}
+	}
+	return 0, &FrontMatterError{start + 1, fmt.Errorf("missing closing %q", fence)}
+}
+
+var yamlKeyRegex = regexp.MustCompile(`^[A-Za-z_][\w-]*:(\s|$)`)
+
+// Checks whether the first line between two fences is the key of a mapping,
+// so that YAML front matter with a syntax error can be told apart from a body
+// that happens to be followed by a "---" line.
+func startsWithYAMLKey(lines []string, start, end int) bool {
+	for i := start + 1; i < end; i++ {
+		line := strings.TrimSpace(lines[i])
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return yamlKeyRegex.MatchString(line)
+		}
+	}
+	return false
+}
+
+func parseYAMLFrontMatter(lines []string, start, end int) (*FrontMatter, error) {
+	doc := yaml.Node{}
+	err := yaml.Unmarshal([]byte(padLines(lines, start, end)), &doc)
+	if err != nil {
+		return nil, yamlErrorToFrontMatterError(err.Error(), start+1)
+	}
+
+	if len(doc.Content) == 0 {
+		return newFrontMatter(FormatYAML, nil), nil
+	}
+
+	node := doc.Content[0]
+	if node.Kind != yaml.MappingNode {
+		return nil, &FrontMatterError{node.Line, errors.New("front matter must be a mapping of keys to values")}
+	}
+
+	return &FrontMatter{FormatYAML, node}, nil
+}
+
+func parseTOMLFrontMatter(lines []string, start, end int) (*FrontMatter, error) {
+	data := map[string]any{}
+	meta, err := toml.Decode(padLines(lines, start, end), &data)
+
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, &FrontMatterError{parseErr.Position.Line, errors.New(parseErr.Message)}
+	} else if err != nil {
+		return nil, &FrontMatterError{start + 1, err}
+	}
+
+	// the TOML decoder does not expose line numbers, so each top-level key is
+	// attributed to the first line that assigns it or opens its table
+	fm := newFrontMatter(FormatTOML, nil)
+	for _, key := range meta.Keys() {
+		if len(key) != 1 {
+			continue
+		}
+
+		name := key[0]
+		line := findTOMLKeyLine(lines, start, end, name)
+
+		valueNode := &yaml.Node{}
+		if err := valueNode.Encode(data[name]); err != nil {
+			return nil, &FrontMatterError{line, err}
+		}
+		setNodeLine(valueNode, line)
+
+		keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name, Line: line}
+		fm.node.Content = append(fm.node.Content, keyNode, valueNode)
+	}
+
+	return fm, nil
+}
+
+// Parses the original front matter format: "key: value" lines until a line
+// that starts with "---". Keys are case insensitive and values are taken
+// verbatim, but are typed like plain YAML scalars when decoded.
+func parseBareFrontMatter(lines []string, start int) (*FrontMatter, int, error) {
+	fm := newFrontMatter(FormatBare, nil)
+
+	i := start
+	for ; i < len(lines); i++ {
+		lineStr := strings.TrimSpace(lines[i])
+
+		if lineStr == "" {
+			continue
+		}
+		if strings.HasPrefix(lineStr, "---") {
+			i++
+			break
+		}
+
+		name, value, found := strings.Cut(lineStr, ":")
+		if !found {
+			return nil, 0, &FrontMatterError{i + 1, fmt.Errorf("expected \"key: value\", got %q", lineStr)}
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		fm.node.Content = append(fm.node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name, Line: i + 1},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: value, Line: i + 1},
+		)
+	}
+
+	return fm, i, nil
+}
+
+func newFrontMatter(format string, node *yaml.Node) *FrontMatter {
+	if node == nil {
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return &FrontMatter{format, node}
+}
+
+// Joins the lines between two fences, padded with empty lines so that line
+// numbers reported by decoders match the line numbers in the document.
+func padLines(lines []string, start, end int) string {
+	return strings.Repeat("\n", start+1) + strings.Join(lines[start+1:end], "\n")
+}
+
+func findTOMLKeyLine(lines []string, start, end int, key string) int {
+	keyRegex := regexp.MustCompile(`^\s*(\[\s*)?"?` + regexp.QuoteMeta(key) + `"?\s*[=\].]`)
+	for i := start + 1; i < end; i++ {
+		if keyRegex.MatchString(lines[i]) {
+			return i + 1
+		}
+	}
+	return start + 1
+}
+
+func setNodeLine(node *yaml.Node, line int) {
+	node.Line = line
+	for _, child := range node.Content {
+		setNodeLine(child, line)
+	}
+}
+
+var yamlLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// Converts a YAML error message that starts with a line number into an error
+// with that line number, or the default line if the message has none.
+func yamlErrorToFrontMatterError(msg string, defaultLine int) error {
+	match := yamlLineRegex.FindStringSubmatch(msg)
+	if match == nil {
+		return &FrontMatterError{defaultLine, errors.New(strings.TrimPrefix(msg, "yaml: "))}
+	}
+
+	line, _ := strconv.Atoi(match[1])
+	return &FrontMatterError{line, errors.New(msg[len(match[0]):])}
+}
@@ -0,0 +1,128 @@
+package md
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testFrontMatter struct {
+	Title string    `yaml:"title"`
+	Tags  List      `yaml:"tags"`
+	Date  time.Time `yaml:"date"`
+	Draft bool      `yaml:"draft"`
+}
+
+func TestParseFrontMatterFormats(t *testing.T) {
+	docs := map[string]string{
+		FormatYAML: "---\ntitle: \"Hello: world\"\ntags:\n  - go\n  - web\ndate: 2025-02-01T14:42:55Z\ndraft: true\nextra: 1\n---\n\nbody",
+		FormatTOML: "+++\ntitle = \"Hello: world\"\ntags = [\"go\", \"web\"]\ndate = 2025-02-01T14:42:55Z\ndraft = true\nextra = 1\n+++\n\nbody",
+		FormatBare: "title: Hello: world\ntags: go, web\ndate: 2025-02-01T14:42:55Z\nDraft: true\nextra: 1\n\n---\n\nbody",
+	}
+
+	extraLines := map[string]int{FormatYAML: 8, FormatTOML: 6, FormatBare: 5}
+
+	for format, src := range docs {
+		doc, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", format, err)
+		}
+		if doc.Head.Format != format {
+			t.Errorf("%s: expected format %q, got %q", format, format, doc.Head.Format)
+		}
+		if string(doc.Body) != "<p>body</p>" {
+			t.Errorf("%s: unexpected body %q", format, doc.Body)
+		}
+
+		head := testFrontMatter{}
+		if err := doc.Head.Decode(&head); err != nil {
+			t.Fatalf("%s: unexpected decode error: %v", format, err)
+		}
+		if head.Title != "Hello: world" {
+			t.Errorf("%s: unexpected title %q", format, head.Title)
+		}
+		if strings.Join(head.Tags, ",") != "go,web" {
+			t.Errorf("%s: unexpected tags %q", format, head.Tags)
+		}
+		if !head.Date.Equal(time.Date(2025, 2, 1, 14, 42, 55, 0, time.UTC)) {
+			t.Errorf("%s: unexpected date %v", format, head.Date)
+		}
+		if !head.Draft {
+			t.Errorf("%s: expected draft to be true", format)
+		}
+
+		unknown := doc.Head.UnknownKeys(&head)
+		if len(unknown) != 1 || unknown[0].Name != "extra" || unknown[0].Line != extraLines[format] {
+			t.Errorf("%s: unexpected unknown keys %v", format, unknown)
+		}
+	}
+}
+
+func TestParseFrontMatterErrorLines(t *testing.T) {
+	docs := map[string]string{
+		"yaml syntax": "---\ntitle: ok\ntags: a: b\n---\nbody",
+		"toml syntax": "+++\ntitle = \"ok\"\ntags = \n+++\nbody",
+		"bare syntax": "title: ok\nno colon here\n---\nbody",
+	}
+	expLines := map[string]int{
+		"yaml syntax": 3,
+		"toml syntax": 3,
+		"bare syntax": 2,
+	}
+
+	for name, src := range docs {
+		_, err := Parse(strings.NewReader(src))
+
+		var fmErr *FrontMatterError
+		if !errors.As(err, &fmErr) {
+			t.Fatalf("%s: expected a front matter error, got %v", name, err)
+		}
+		if fmErr.Line != expLines[name] {
+			t.Errorf("%s: expected line %d, got %d (%v)", name, expLines[name], fmErr.Line, err)
+		}
+	}
+}
+
+func TestParseFrontMatterEmptyBareHeader(t *testing.T) {
+	docs := map[string]string{
+		"unclosed":        "\n\n---\ntitle: ok\nbody",
+		"horizontal rule": "---\nFirst part\n\n---\n\nSecond part",
+		"list":            "---\n- one\n- two\n---\nbody",
+	}
+	expBodies := map[string]string{
+		"unclosed":        "<p>title: ok\nbody</p>",
+		"horizontal rule": "<p>First part</p>\n\n<hr>\n\n<p>Second part</p>",
+		"list":            "<ul>\n<li>one</li>\n<li>two\n&mdash;\nbody</li>\n</ul>",
+	}
+
+	for name, src := range docs {
+		doc, err := Parse(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if doc.Head.Format != FormatBare || len(doc.Head.Keys()) != 0 {
+			t.Errorf("%s: expected an empty bare header, got %q with %v", name, doc.Head.Format, doc.Head.Keys())
+		}
+		if string(doc.Body) != expBodies[name] {
+			t.Errorf("%s: unexpected body %q", name, doc.Body)
+		}
+	}
+}
+
+func TestDecodeFrontMatterErrorLines(t *testing.T) {
+	doc, err := Parse(strings.NewReader("---\ntitle: ok\ndate: not a date\n---\nbody"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = doc.Head.Decode(&testFrontMatter{})
+
+	var fmErr *FrontMatterError
+	if !errors.As(err, &fmErr) {
+		t.Fatalf("expected a front matter error, got %v", err)
+	}
+	if fmErr.Line != 3 {
+		t.Errorf("expected line 3, got %d (%v)", fmErr.Line, err)
+	}
+}
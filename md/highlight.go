@@ -47,6 +47,11 @@ func highlightCodeBlock(codeBlock *ast.CodeBlock) string {
 	return htmlBuf.String()
 }
 
+// Checks whether a code block language is recognized for syntax highlighting.
+func IsKnownLang(lang string) bool {
+	return lexers.Get(lang) != nil
+}
+
 func lexerForCode(lang, code string) chroma.Lexer {
 	if lang != "" {
 		if lexer := lexers.Get(lang); lexer != nil {
@@ -0,0 +1,44 @@
+package md
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/mecha/mecha.dev/images"
+)
+
+// Renders a markdown image as a lazily loaded <img>. Images in the assets are
+// given their dimensions and a srcset of their resized variants, wrapped in a
+// <picture> if they also have WebP versions.
+func renderImage(image *ast.Image) string {
+	src := string(image.Destination)
+
+	attrs := []string{
+		`src="` + html.EscapeString(src) + `"`,
+		`alt="` + html.EscapeString(nodeText(image)) + `"`,
+	}
+	if len(image.Title) > 0 {
+		attrs = append(attrs, `title="`+html.EscapeString(string(image.Title))+`"`)
+	}
+
+	img, isAsset := images.Lookup(src)
+	if isAsset {
+		attrs = append(attrs,
+			`srcset="`+html.EscapeString(images.Srcset(img.Candidates()))+`"`,
+			`sizes="`+images.Sizes+`"`,
+			`width="`+strconv.Itoa(img.Width)+`"`,
+			`height="`+strconv.Itoa(img.Height)+`"`,
+		)
+	}
+	attrs = append(attrs, `loading="lazy"`)
+
+	imgTag := "<img " + strings.Join(attrs, " ") + " />"
+	if !isAsset || !img.HasWebP() {
+		return imgTag
+	}
+
+	srcset := html.EscapeString(images.Srcset(img.WebPCandidates()))
+	return `<picture><source type="image/webp" srcset="` + srcset + `" sizes="` + images.Sizes + `" />` + imgTag + `</picture>`
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"html/template"
 	"io"
-	"log/slog"
 	"os"
 	"strings"
 
@@ -17,9 +16,23 @@ import (
 // A parsed markdown document
 type ParsedDoc struct {
 	// The front-matter data
-	Head map[string]string
+	Head *FrontMatter
 	// The converted HTML of the document
 	Body template.HTML
+	// The languages of the fenced code blocks in the document, in order
+	CodeLangs []string
+	// The headings of the document, in order
+	Outline []Heading
+	// The number of words in the document's text, excluding code blocks
+	WordCount int
+}
+
+// A heading in a markdown document
+type Heading struct {
+	Level int
+	Text  string
+	// The ID of the heading element, for linking to it
+	ID string
 }
 
 // Parses a markdown file with front-matter support.
@@ -28,71 +41,142 @@ func ParseFile(filepath string) (*ParsedDoc, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 	return Parse(file)
 }
 
-// Parses a markdown string with front-matter support.
+// Parses a markdown string with front-matter support. The front matter can be
+// YAML fenced by "---" lines, TOML fenced by "+++" lines, or bare "key: value"
+// lines ended by a "---" line. Front matter errors are *FrontMatterError values.
 func Parse(reader io.Reader) (*ParsedDoc, error) {
-	head := make(map[string]string)
-
+	var lines []string
 	scanner := bufio.NewScanner(reader)
-	for lineNum := 0; scanner.Scan(); lineNum++ {
-		lineStr := strings.TrimSpace(scanner.Text())
-
-		if lineStr == "" {
-			continue
-		}
-		if strings.HasPrefix(lineStr, "---") {
-			break
-		}
-
-		name, value, found := strings.Cut(lineStr, ":")
-		if !found {
-			slog.Error("syntax error in markdown front matter", "line", lineNum)
-			continue
-		}
-		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
-		head[name] = value
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
 	}
 
-	var mdStr strings.Builder
-	for scanner.Scan() {
-		mdStr.WriteString(scanner.Text() + "\n")
+	head, bodyStart, err := parseFrontMatter(lines)
+	if err != nil {
+		return nil, err
 	}
-	body := ToHTML(strings.TrimSpace(mdStr.String()))
 
-	return &ParsedDoc{head, body}, nil
+	mdStr := strings.Join(lines[bodyStart:], "\n")
+	ast := parseMarkdown(strings.TrimSpace(mdStr))
+
+	return &ParsedDoc{head, renderHTML(ast), codeLangs(ast), outline(ast), wordCount(ast)}, nil
 }
 
 // Converts a markdown string into HTML
 func ToHTML(md string) template.HTML {
+	return renderHTML(parseMarkdown(md))
+}
+
+func parseMarkdown(md string) mdAst.Node {
 	parser := mdParser.NewWithExtensions(
 		mdParser.CommonExtensions | mdParser.AutoHeadingIDs | mdParser.NoEmptyLineBeforeBlock,
 	)
+	ast := parser.Parse([]byte(md))
+
+	autoLinkHeadings(ast)
+
+	return ast
+}
+
+func renderHTML(ast mdAst.Node) template.HTML {
 	renderer := mdHtml.NewRenderer(mdHtml.RendererOptions{
 		Flags:          mdHtml.CommonFlags | mdHtml.HrefTargetBlank,
 		RenderNodeHook: renderNodeHook,
 	})
-	ast := parser.Parse([]byte(md))
-
-	autoLinkHeadings(ast)
 
 	htmlStr := string(markdown.Render(ast, renderer))
 	return template.HTML(strings.TrimSpace(htmlStr))
 }
 
-// hook into node rendering to add syntax highlighting
+// Collects the languages of the fenced code blocks in a markdown AST
+func codeLangs(ast mdAst.Node) []string {
+	langs := []string{}
+	mdAst.WalkFunc(ast, func(node mdAst.Node, entering bool) mdAst.WalkStatus {
+		if codeBlock, isCodeBlock := node.(*mdAst.CodeBlock); isCodeBlock && entering {
+			if lang := codeBlockLang(codeBlock); lang != "" {
+				langs = append(langs, lang)
+			}
+		}
+		return mdAst.GoToNext
+	})
+	return langs
+}
+
+// hook into node rendering to add syntax highlighting and responsive images
 func renderNodeHook(w io.Writer, node mdAst.Node, entering bool) (mdAst.WalkStatus, bool) {
-	codeBlock, isCodeBlock := node.(*mdAst.CodeBlock)
-	if !isCodeBlock {
+	switch node := node.(type) {
+	case *mdAst.CodeBlock:
+		if entering {
+			io.WriteString(w, highlightCodeBlock(node))
+		}
+		return mdAst.GoToNext, true
+	case *mdAst.Image:
+		// the alt text is rendered from the children, so they are skipped
+		if entering {
+			io.WriteString(w, renderImage(node))
+		}
+		return mdAst.SkipChildren, true
+	default:
 		return mdAst.GoToNext, false
 	}
+}
 
-	if entering {
-		io.WriteString(w, highlightCodeBlock(codeBlock))
-	}
+// Collects the headings in a markdown AST that have IDs
+func outline(ast mdAst.Node) []Heading {
+	headings := []Heading{}
+	mdAst.WalkFunc(ast, func(node mdAst.Node, entering bool) mdAst.WalkStatus {
+		heading, isHeading := node.(*mdAst.Heading)
+		if !isHeading || !entering {
+			return mdAst.GoToNext
+		}
+
+		if heading.HeadingID != "" {
+			headings = append(headings, Heading{heading.Level, nodeText(heading), heading.HeadingID})
+		}
+		return mdAst.SkipChildren
+	})
+	return headings
+}
 
-	return mdAst.GoToNext, true
+// Counts the words in the text of a markdown AST. Code blocks are leaves
+// without text children, so they are not counted.
+func wordCount(ast mdAst.Node) int {
+	var text strings.Builder
+	mdAst.WalkFunc(ast, func(node mdAst.Node, entering bool) mdAst.WalkStatus {
+		switch node := node.(type) {
+		case *mdAst.Text:
+			text.Write(node.Literal)
+		case *mdAst.Code:
+			text.Write(node.Literal)
+		case *mdAst.Paragraph, *mdAst.Heading, *mdAst.ListItem, *mdAst.TableCell:
+			// separate the text of blocks, which is otherwise joined together
+			text.WriteByte(' ')
+		}
+		return mdAst.GoToNext
+	})
+	return len(strings.Fields(text.String()))
+}
+
+// Concatenates the text inside a markdown AST node, without any formatting
+func nodeText(node mdAst.Node) string {
+	var text strings.Builder
+	mdAst.WalkFunc(node, func(node mdAst.Node, entering bool) mdAst.WalkStatus {
+		switch leaf := node.(type) {
+		case *mdAst.Text:
+			text.Write(leaf.Literal)
+		case *mdAst.Code:
+			text.Write(leaf.Literal)
+		}
+		return mdAst.GoToNext
+	})
+	return strings.TrimSpace(text.String())
 }
 
 // Adds an anchor link inside each level 2+ heading that links to itself
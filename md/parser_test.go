@@ -1,8 +1,14 @@
 package md
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/mecha/mecha.dev/images"
 )
 
 func TestToHTMLHighlightsFencedCodeBlocks(t *testing.T) {
@@ -20,3 +26,72 @@ func TestToHTMLHighlightsFencedCodeBlocks(t *testing.T) {
 		t.Fatalf("expected class-based highlighting without inline styles, got %q", html)
 	}
 }
+
+func TestParseCollectsCodeLangs(t *testing.T) {
+	doc, err := Parse(strings.NewReader("title: x\n---\n```go\nx\n```\n\n```\ny\n```\n\n```klingon\nz\n```"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Join(doc.CodeLangs, ",") != "go,klingon" {
+		t.Fatalf("unexpected code languages %q", doc.CodeLangs)
+	}
+
+	if !IsKnownLang("go") || IsKnownLang("klingon") {
+		t.Fatalf("expected go to be known and klingon to be unknown")
+	}
+}
+
+func TestParseOutline(t *testing.T) {
+	doc, err := Parse(strings.NewReader("title: x\n---\n# Intro\n\ntext\n\n## The `ELF` *header*\n\n### Fields\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Heading{
+		{1, "Intro", "intro"},
+		{2, "The ELF header", "the-elf-header"},
+		{3, "Fields", "fields"},
+	}
+	if len(doc.Outline) != len(expected) {
+		t.Fatalf("expected %d headings, got %v", len(expected), doc.Outline)
+	}
+	for i, heading := range expected {
+		if doc.Outline[i] != heading {
+			t.Errorf("expected heading %v, got %v", heading, doc.Outline[i])
+		}
+	}
+}
+
+func TestParseWordCount(t *testing.T) {
+	doc, err := Parse(strings.NewReader("title: x\n---\n## Two words\n\nThree *more* `words`.\n\n```go\nfunc main() { not counted }\n```\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if doc.WordCount != 5 {
+		t.Fatalf("expected 5 words, got %d", doc.WordCount)
+	}
+}
+
+func TestToHTMLResponsiveImages(t *testing.T) {
+	var logo bytes.Buffer
+	png.Encode(&logo, image.NewRGBA(image.Rect(0, 0, 1000, 800)))
+	images.FS = fstest.MapFS{"logo.png": {Data: logo.Bytes()}}
+	defer func() {
+		images.FS = nil
+		images.ClearCache()
+	}()
+
+	html := string(ToHTML(`![the "logo"](/assets/logo.png "Logo")`))
+	expected := `<picture><source type="image/webp" srcset="/assets/logo.480w.png.webp 480w, /assets/logo.960w.png.webp 960w, /assets/logo.png.webp 1000w" sizes="(max-width: 960px) 100vw, 960px" />` +
+		`<img src="/assets/logo.png" alt="the &#34;logo&#34;" title="Logo" srcset="/assets/logo.480w.png 480w, /assets/logo.960w.png 960w, /assets/logo.png 1000w" sizes="(max-width: 960px) 100vw, 960px" width="1000" height="800" loading="lazy" /></picture>`
+	if !strings.Contains(html, expected) {
+		t.Fatalf("expected responsive image, got %q", html)
+	}
+
+	html = string(ToHTML(`![remote](https://example.com/a.png)`))
+	if !strings.Contains(html, `<img src="https://example.com/a.png" alt="remote" loading="lazy" />`) {
+		t.Fatalf("expected lazy image without srcset, got %q", html)
+	}
+}
@@ -79,31 +79,43 @@ func LoadFromFile(fsys fs.FS, filepath string) (*Project, error) {
 	return project, nil
 }
 
+// The front matter of a project file.
+type FrontMatter struct {
+	Name  string `yaml:"name"`
+	Desc  string `yaml:"desc"`
+	Repo  string `yaml:"repo"`
+	URL   string `yaml:"url"`
+	Langs string `yaml:"langs"`
+}
+
 func Parse(reader io.Reader) (*Project, error) {
 	doc, err := md.Parse(reader)
 	if err != nil {
 		return nil, err
 	}
 
-	project := &Project{
-		Body: doc.Body,
+	for _, key := range doc.Head.UnknownKeys(&FrontMatter{}) {
+		slog.Warn("projects: unknown property", "property", key.Name, slog.Int("line", key.Line))
 	}
 
-	for key, val := range doc.Head {
-		switch strings.ToLower(key) {
-		case "name":
-			project.Name = val
-		case "desc":
-			project.Desc = val
-		case "repo":
-			project.Repo = val
-		case "url":
-			project.URL = val
-		case "langs":
-			project.Langs = val
-		default:
-			slog.Warn("projects: unknown property", "property", key)
-		}
+	return FromDoc(doc)
+}
+
+// Creates a project from its parsed markdown, without warning about unknown
+// front matter keys.
+func FromDoc(doc *md.ParsedDoc) (*Project, error) {
+	head := FrontMatter{}
+	if err := doc.Head.Decode(&head); err != nil {
+		return nil, err
+	}
+
+	project := &Project{
+		Name:  head.Name,
+		Desc:  head.Desc,
+		URL:   head.URL,
+		Repo:  head.Repo,
+		Langs: head.Langs,
+		Body:  doc.Body,
 	}
 
 	return project, nil
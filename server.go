@@ -3,43 +3,74 @@ package main
 import (
 	"database/sql"
 	"errors"
+	"io/fs"
 	"log/slog"
 	"math"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mecha/mecha.dev/assets"
 	"github.com/mecha/mecha.dev/blog"
+	"github.com/mecha/mecha.dev/images"
 	"github.com/mecha/mecha.dev/projects"
+	"github.com/mecha/mecha.dev/site"
 	"github.com/mecha/mecha.dev/views"
 )
 
 const NumPostsPerPage = 20
 
-func runHttpServer() {
-	addr := ":" + strconv.Itoa(Flags.PortNum)
-	slog.Info("Listening and serving HTTP", "addr", addr)
+var FeedFormats = []string{"rss", "atom", "json"}
 
-	handler := createHttpHandler()
-	err := http.ListenAndServe(addr, handler)
+func newHttpServer() *http.Server {
+	server := &http.Server{
+		Addr:         ":" + strconv.Itoa(Flags.PortNum),
+		Handler:      createHttpHandler(),
+		ReadTimeout:  Flags.ReadTimeout,
+		WriteTimeout: Flags.WriteTimeout,
+		IdleTimeout:  Flags.IdleTimeout,
+	}
+	server.RegisterOnShutdown(liveReload.Close)
+	return server
+}
 
-	if !errors.Is(err, http.ErrServerClosed) {
-		slog.Error("unexpected server error:" + err.Error())
+// Serves HTTP until the server is shut down, in which case nil is returned.
+func runHttpServer(server *http.Server) error {
+	slog.Info("Listening and serving HTTP", "addr", server.Addr)
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
+	return err
 }
 
 func createHttpHandler() http.Handler {
 	mux := http.NewServeMux()
 
-	publicFS := http.FS(getFS("embed/public"))
-	publicHandler := http.StripPrefix("/assets", http.FileServer(publicFS))
+	publicFS := http.FS(getFS(PublicDir))
+	publicHandler := http.StripPrefix("/assets", images.Handler(http.FileServer(publicFS)))
 	mux.HandleFunc("/assets/", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/assets/" {
 			w.WriteHeader(404) // prevent listing contents of assets dir
-		} else {
-			publicHandler.ServeHTTP(w, r)
+			return
+		}
+
+		// fingerprinted URLs of outdated content are still served, but must be
+		// revalidated, since their content does not match their hash
+		if name, isCurrent, ok := assets.Resolve(strings.TrimPrefix(r.URL.Path, "/assets/")); ok {
+			if isCurrent {
+				w.Header().Set("Cache-Control", immutableCacheControl)
+			} else {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+			r = r.Clone(r.Context())
+			r.URL.Path = "/assets/" + name
 		}
+		publicHandler.ServeHTTP(w, r)
 	})
 
 	projectsFs := http.StripPrefix("/projects", http.FileServer(http.Dir("public/projects")))
@@ -51,49 +82,43 @@ func createHttpHandler() http.Handler {
 		}
 	})
 
-	mux.HandleFunc("/blog", func(w http.ResponseWriter, r *http.Request) {
-		query := r.URL.Query()
-		search := strings.TrimSpace(query.Get("q"))
+	mux.HandleFunc("/blog", handleBlogList)
+	mux.HandleFunc("/blog/page/{page}", handleBlogList)
+	mux.HandleFunc("/blog/tag/{tag}", handleBlogList)
+	mux.HandleFunc("/blog/tag/{tag}/page/{page}", handleBlogList)
 
-		page, err := strconv.Atoi(query.Get("page"))
-		if page < 1 || err != nil {
-			page = 1
-		}
-
-		pageSize, err := strconv.Atoi(query.Get("num"))
-		if pageSize < 1 || err != nil {
-			pageSize = NumPostsPerPage
-		}
-
-		posts, err := blog.SearchPosts(search, pageSize, pageSize*(page-1))
+	mux.HandleFunc("/blog/tags", func(w http.ResponseWriter, r *http.Request) {
+		tags, err := blog.GetTags()
 		if err != nil {
-			slog.Error("error searching posts: " + err.Error())
-			w.WriteHeader(500)
-			return
-		}
-
-		total, err := blog.NumPublicPosts()
-		if err != nil {
-			slog.Error("error counting posts: " + err.Error())
 			w.WriteHeader(500)
+			views.Write("500.gotmpl", w, err)
 			return
 		}
-
-		numPages := int(math.Ceil(float64(total) / float64(pageSize)))
-
-		views.Write("blog.gotmpl", w, map[string]any{
-			"Posts":    posts,
-			"Search":   search,
-			"Page":     page,
-			"NumPages": numPages,
-		})
+		views.Write("blog-tags.gotmpl", w, tags)
 	})
 
 	mux.HandleFunc("/blog/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		post, err := blog.GetPostBySlug(id)
+
+		// posts that are not listed yet can only be seen with a preview token
+		if err == nil && !post.IsVisible(time.Now()) {
+			if !hasPreviewToken(post, r.URL) {
+				err = sql.ErrNoRows
+			} else {
+				w.Header().Set("X-Robots-Tag", "noindex")
+				w.Header().Set("Cache-Control", "no-store")
+			}
+		}
+
+		var data map[string]any
+		if err == nil {
+			data, err = blogPostData(post)
+		}
+
 		if err == nil {
-			views.Write("blog-post.gotmpl", w, post)
+			w.Header().Set("Last-Modified", httpTime(postPageModified(data)))
+			views.Write("blog-post.gotmpl", w, data)
 		} else if errors.Is(err, sql.ErrNoRows) {
 			w.WriteHeader(404)
 			views.Write("404.gotmpl", w, nil)
@@ -103,24 +128,19 @@ func createHttpHandler() http.Handler {
 		}
 	})
 
-	mux.HandleFunc("/blog/feed", func(w http.ResponseWriter, r *http.Request) {
-		format := r.URL.Query().Get("format")
-		if format == "" {
-			format = "rss"
-		}
-
-		page, err := strconv.Atoi(r.URL.Query().Get("page"))
-		if page < 1 || err != nil {
-			page = 1
-		}
+	mux.HandleFunc("/blog/{id}/{file...}", handleBlogBundleFile)
 
-		err = blog.WriteFeed(w, NumPostsPerPage, page, format)
-		if err != nil {
-			w.WriteHeader(500)
-			views.Write("500.gotmpl", w, err)
-		}
+	mux.HandleFunc("/blog/feed", func(w http.ResponseWriter, r *http.Request) {
+		handleBlogFeed(w, r, r.URL.Query().Get("format"))
 	})
 
+	// path-based aliases for the feed formats, for static hosts that ignore query strings
+	for _, format := range FeedFormats {
+		mux.HandleFunc("/blog/feed."+format, func(w http.ResponseWriter, r *http.Request) {
+			handleBlogFeed(w, r, format)
+		})
+	}
+
 	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
 		data := map[string]any{
 			"ProYears":       time.Now().Year() - 2013,
@@ -129,10 +149,9 @@ func createHttpHandler() http.Handler {
 		views.Write("about.gotmpl", w, data)
 	})
 
-	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("User-Agent: *\n"))
-		w.Write([]byte("Allow: /"))
-	})
+	mux.HandleFunc("/robots.txt", handleRobotsTxt)
+	mux.HandleFunc("/sitemap.xml", handleSitemap)
+	mux.HandleFunc("/sitemaps/{file}", handleSitemapPage)
 
 	mux.HandleFunc("/500", func(w http.ResponseWriter, r *http.Request) {
 		views.Write("500.gotmpl", w, errors.New("something is about to blow"))
@@ -149,5 +168,251 @@ func createHttpHandler() http.Handler {
 		}
 	})
 
-	return gzipHandler(mux)
+	handler := gzipHandler(cacheHandler(mux))
+	if !isDevMode() {
+		return handler
+	}
+
+	// the live reload stream must not be buffered by the cache handler
+	devMux := http.NewServeMux()
+	devMux.Handle(LiveReloadPath, liveReload)
+	devMux.Handle("/", handler)
+	return devMux
+}
+
+func handleBlogList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := strings.TrimSpace(query.Get("q"))
+
+	tag := r.PathValue("tag")
+	if tag == "" {
+		tag = query.Get("tag")
+	}
+	tag = blog.NormalizeTag(tag)
+
+	pageStr := r.PathValue("page")
+	if pageStr == "" {
+		pageStr = query.Get("page")
+	}
+	page, err := strconv.Atoi(pageStr)
+	if page < 1 || err != nil {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(query.Get("num"))
+	if pageSize < 1 || err != nil {
+		pageSize = NumPostsPerPage
+	}
+
+	filter := blog.Filter{Search: search, Tag: tag}
+	posts, err := blog.SearchPosts(filter, pageSize, pageSize*(page-1))
+	if err != nil {
+		slog.Error("error searching posts: " + err.Error())
+		w.WriteHeader(500)
+		return
+	}
+
+	total, err := blog.CountSearchResults(filter)
+	if err != nil {
+		slog.Error("error counting posts: " + err.Error())
+		w.WriteHeader(500)
+		return
+	}
+
+	numPages := int(math.Ceil(float64(total) / float64(pageSize)))
+
+	baseURL := "/blog"
+	if tag != "" {
+		baseURL = "/blog/tag/" + tag
+	}
+
+	// keep the search and page size when navigating between pages
+	pageQuery := url.Values{}
+	if search != "" {
+		pageQuery.Set("q", search)
+	}
+	if pageSize != NumPostsPerPage {
+		pageQuery.Set("num", strconv.Itoa(pageSize))
+	}
+	pageQueryStr := ""
+	if len(pageQuery) > 0 {
+		pageQueryStr = "?" + pageQuery.Encode()
+	}
+
+	views.Write("blog.gotmpl", w, map[string]any{
+		"Posts":     posts,
+		"Search":    search,
+		"Tag":       tag,
+		"BaseURL":   baseURL,
+		"PageQuery": pageQueryStr,
+		"Page":      page,
+		"NumPages":  numPages,
+	})
+}
+
+// Serves a file from the bundle of a post. The files of posts that are not
+// listed yet are only served to requests for, or from, their preview pages.
+func handleBlogBundleFile(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	if file == "" {
+		http.Redirect(w, r, strings.TrimSuffix(r.URL.Path, "/"), http.StatusMovedPermanently)
+		return
+	}
+
+	post, err := blog.GetPostBySlug(r.PathValue("id"))
+	if err == nil && !post.IsVisible(time.Now()) {
+		referer, _ := url.Parse(r.Referer())
+		if !hasPreviewToken(post, r.URL) && (referer == nil || !hasPreviewToken(post, referer)) {
+			err = sql.ErrNoRows
+		} else {
+			w.Header().Set("X-Robots-Tag", "noindex")
+			w.Header().Set("Cache-Control", "no-store")
+		}
+	}
+
+	dir := ""
+	if err == nil {
+		dir, err = blog.GetBundleDir(post.Slug)
+	}
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(500)
+		views.Write("500.gotmpl", w, err)
+		return
+	}
+
+	// the post's markdown source is not served
+	if err != nil || dir == "" || path.Ext(file) == ".md" {
+		w.WriteHeader(404)
+		views.Write("404.gotmpl", w, nil)
+		return
+	}
+
+	// the directories of a bundle are not listed
+	bundleFS := getFS(path.Join(PostsDir, dir))
+	if info, err := fs.Stat(bundleFS, file); err != nil || info.IsDir() {
+		w.WriteHeader(404)
+		views.Write("404.gotmpl", w, nil)
+		return
+	}
+	http.ServeFileFS(w, r, bundleFS, file)
+}
+
+// Checks whether a URL has a valid preview token for a post in its query.
+func hasPreviewToken(post *blog.Post, u *url.URL) bool {
+	token := u.Query().Get("preview")
+	return blog.VerifyPreviewToken(post.Slug, token, time.Now(), []byte(Flags.PreviewSecret)) == nil
+}
+
+func handleBlogFeed(w http.ResponseWriter, r *http.Request, format string) {
+	if format == "" {
+		format = "rss"
+	}
+
+	query := r.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if page < 1 || err != nil {
+		page = 1
+	}
+
+	fullContent := site.Current.Feed.FullContent
+	if content := query.Get("content"); content != "" {
+		fullContent = content == "full"
+	}
+
+	opts := blog.FeedOptions{
+		Filter: blog.Filter{
+			Search: query.Get("q"),
+			Tag:    query.Get("tag"),
+			Author: query.Get("author"),
+		},
+		NumItems:    NumPostsPerPage,
+		Page:        page,
+		Format:      format,
+		FullContent: fullContent,
+	}
+
+	feed, err := blog.NewPostFeed(opts)
+	if err == nil {
+		w.Header().Set("Content-Type", blog.FeedContentType(format))
+		if !feed.Updated.IsZero() {
+			w.Header().Set("Last-Modified", httpTime(feed.Updated))
+		}
+		err = feed.Write(w, format)
+	}
+	if err != nil {
+		slog.Error("error writing feed: " + err.Error())
+		w.Header().Del("Content-Type")
+		w.Header().Del("Last-Modified")
+		w.WriteHeader(500)
+		views.Write("500.gotmpl", w, err)
+	}
+}
+
+// The time that a post's page last changed, which is the latest time that any
+// of the posts that it renders changed, or that the templates were loaded.
+func postPageModified(data map[string]any) time.Time {
+	modified := startTime
+	for _, value := range data {
+		switch value := value.(type) {
+		case *blog.Post:
+			if value != nil {
+				modified = latestTime(modified, value.LastModified())
+			}
+		case []*blog.Post:
+			for _, post := range value {
+				modified = latestTime(modified, post.LastModified())
+			}
+		}
+	}
+	return modified
+}
+
+func latestTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// Formats a time for HTTP headers, such as Last-Modified.
+func httpTime(t time.Time) string {
+	return t.UTC().Format(http.TimeFormat)
+}
+
+// Collects the template data for a post's page, including the posts that it
+// links to in its series and by date.
+func blogPostData(post *blog.Post) (map[string]any, error) {
+	data := map[string]any{"Post": post}
+
+	prev, next, err := blog.GetAdjacentPosts(post)
+	if err != nil {
+		return nil, err
+	}
+	data["Prev"], data["Next"] = prev, next
+
+	if post.Series == "" {
+		return data, nil
+	}
+
+	series, err := blog.GetSeriesPosts(post.Series)
+	if err != nil {
+		return nil, err
+	}
+	data["Series"] = series
+
+	for i, seriesPost := range series {
+		if seriesPost.Slug != post.Slug {
+			continue
+		}
+		data["SeriesPart"] = i + 1
+		if i > 0 {
+			data["SeriesPrev"] = series[i-1]
+		}
+		if i < len(series)-1 {
+			data["SeriesNext"] = series[i+1]
+		}
+	}
+
+	return data, nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mecha/mecha.dev/assets"
+	"github.com/mecha/mecha.dev/blog"
+	"github.com/mecha/mecha.dev/views"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestServer(t *testing.T) *httptest.Server {
+	err := blog.InitDB()
+	assert.Nil(t, err, "should be able to init db without error")
+	views.TemplateFS = getFS(TemplatesDir)
+	assets.FS = getFS(PublicDir)
+
+	server := httptest.NewServer(createHttpHandler())
+	t.Cleanup(func() {
+		server.Close()
+		blog.DestroyDB()
+		views.TemplateFS = nil
+		assets.FS = nil
+	})
+	return server
+}
+
+func TestLastModified(t *testing.T) {
+	server := setupTestServer(t)
+
+	updated := startTime.Add(time.Hour).UTC().Truncate(time.Second)
+	posts := []*blog.Post{
+		{Slug: "first", Title: "First", Public: true, Date: time.Date(2025, 06, 01, 0, 0, 0, 0, time.UTC)},
+		{Slug: "second", Title: "Second", Public: true, Date: time.Date(2025, 06, 02, 0, 0, 0, 0, time.UTC), Updated: updated},
+	}
+	for _, post := range posts {
+		err := blog.InsertPost(post)
+		assert.Nil(t, err, "should insert post without error")
+	}
+
+	// the first post's page links to the second post, which changed later
+	for _, path := range []string{"/blog/first", "/blog/second", "/blog/feed", "/blog/feed.json"} {
+		res, _ := doCacheRequest(t, http.MethodGet, server.URL+path, nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode, path)
+		assert.Equal(t, httpTime(updated), res.Header.Get("Last-Modified"), path)
+
+		res, body := doCacheRequest(t, http.MethodGet, server.URL+path, map[string]string{"If-Modified-Since": httpTime(updated)})
+		assert.Equal(t, http.StatusNotModified, res.StatusCode, path)
+		assert.Empty(t, body)
+
+		res, _ = doCacheRequest(t, http.MethodGet, server.URL+path, map[string]string{"If-Modified-Since": httpTime(updated.Add(-time.Minute))})
+		assert.Equal(t, http.StatusOK, res.StatusCode, "%s: should respond if modified since", path)
+	}
+}
+
+func TestLastModifiedTemplates(t *testing.T) {
+	server := setupTestServer(t)
+
+	err := blog.InsertPost(&blog.Post{Slug: "old", Title: "Old", Public: true, Date: time.Date(2025, 06, 01, 0, 0, 0, 0, time.UTC)})
+	assert.Nil(t, err, "should insert post without error")
+
+	res, _ := doCacheRequest(t, http.MethodGet, server.URL+"/blog/old", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, httpTime(startTime), res.Header.Get("Last-Modified"), "pages should not be older than their templates")
+}
+
+func TestFingerprintedAssetCaching(t *testing.T) {
+	server := setupTestServer(t)
+
+	res, _ := doCacheRequest(t, http.MethodGet, server.URL+assets.URL("style.css"), nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, immutableCacheControl, res.Header.Get("Cache-Control"))
+
+	res, _ = doCacheRequest(t, http.MethodGet, server.URL+"/assets/style.00000000.css", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "should serve outdated fingerprints")
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"), "should not cache outdated fingerprints")
+
+	res, _ = doCacheRequest(t, http.MethodGet, server.URL+"/assets/style.css", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "public, max-age=86400", res.Header.Get("Cache-Control"))
+}
@@ -0,0 +1,97 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// The configuration of the site that is currently being served.
+var Current = Default()
+
+// The identity of the site, used to render templates, feeds and absolute URLs.
+type Config struct {
+	// The absolute URL of the site, without a trailing slash
+	BaseURL string `json:"base_url"`
+	// The name of the site
+	Name string `json:"name"`
+	// The URL of the site's source code repository
+	Repo string `json:"repo"`
+	// The authors of the site. The first is the default author of posts.
+	Authors []Author `json:"authors"`
+	// Handles on social platforms
+	Social Social `json:"social"`
+	// Metadata for the blog feeds
+	Feed Feed `json:"feed"`
+}
+
+type Author struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type Social struct {
+	// GitHub username
+	GitHub string `json:"github"`
+	// X/Twitter handle, without the @
+	Twitter string `json:"twitter"`
+}
+
+type Feed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Whether feeds include the full post content by default
+	FullContent bool `json:"full_content"`
+}
+
+// The default configuration, used for any options missing from a config file.
+func Default() *Config {
+	return &Config{
+		BaseURL: "http://localhost:8080",
+		Name:    "localhost",
+		Authors: []Author{},
+	}
+}
+
+// Parses a JSON config. Missing options are taken from the default config.
+func Parse(reader io.Reader) (*Config, error) {
+	config := Default()
+
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse site config: %w", err)
+	}
+
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	return config, nil
+}
+
+// Parses a JSON config file.
+func ParseFile(fsys fs.FS, filepath string) (*Config, error) {
+	file, err := fsys.Open(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open site config: %w", err)
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Creates an absolute URL for a path on the site.
+func (c *Config) URL(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return c.BaseURL + path
+}
+
+// Returns the site's main author, or a zero author if the site has none.
+func (c *Config) Author() Author {
+	if len(c.Authors) == 0 {
+		return Author{}
+	}
+	return c.Authors[0]
+}
@@ -0,0 +1,31 @@
+package site
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	config, err := Parse(strings.NewReader(`{
+		"base_url": "https://example.com/",
+		"authors": [{ "name": "Jane", "email": "jane@example.com" }]
+	}`))
+
+	assert.Nil(t, err, "should parse config without error")
+	assert.Equal(t, "https://example.com", config.BaseURL)
+	assert.Equal(t, "localhost", config.Name, "should default missing options")
+	assert.Equal(t, Author{"Jane", "jane@example.com"}, config.Author())
+}
+
+func TestParseUnknownOption(t *testing.T) {
+	_, err := Parse(strings.NewReader(`{ "baseurl": "https://example.com" }`))
+	assert.NotNil(t, err, "should reject unknown options")
+}
+
+func TestURL(t *testing.T) {
+	config := &Config{BaseURL: "https://example.com"}
+	assert.Equal(t, "https://example.com/blog/test", config.URL("/blog/test"))
+	assert.Equal(t, "https://example.com/blog/test", config.URL("blog/test"))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mecha/mecha.dev/blog"
+	"github.com/mecha/mecha.dev/site"
+)
+
+// The maximum number of URLs in a single sitemap, as set by the sitemap
+// protocol. Larger sitemaps are split into pages listed by a sitemap index.
+const SitemapMaxURLs = 50000
+
+const sitemapXmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// The pages that are always listed in the sitemap.
+var sitemapStaticPages = []string{"/", "/blog", "/blog/tags", "/projects/", "/about"}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// Collects the absolute URLs of all public pages on the site.
+func collectSitemapURLs() ([]sitemapURL, error) {
+	total, err := blog.NumPublicPosts()
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := blog.GetPosts(total, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// listing pages change whenever a post is published or updated
+	latest := time.Time{}
+	for _, post := range posts {
+		if post.LastModified().After(latest) {
+			latest = post.LastModified()
+		}
+	}
+
+	urls := []sitemapURL{}
+	for _, page := range sitemapStaticPages {
+		lastMod := ""
+		if strings.HasPrefix(page, "/blog") && !latest.IsZero() {
+			lastMod = sitemapDate(latest)
+		}
+		urls = append(urls, sitemapURL{site.Current.URL(page), lastMod})
+	}
+
+	tags, err := blog.GetTags()
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		urls = append(urls, sitemapURL{Loc: site.Current.URL("/blog/tag/" + tag.Tag)})
+	}
+
+	for _, post := range posts {
+		urls = append(urls, sitemapURL{site.Current.URL("/blog/" + post.Slug), sitemapDate(post.LastModified())})
+	}
+
+	return urls, nil
+}
+
+// Returns the number of sitemap pages needed for a number of URLs. A single
+// page is served directly from /sitemap.xml, without an index.
+func numSitemapPages(numURLs int) int {
+	return max(1, (numURLs+SitemapMaxURLs-1)/SitemapMaxURLs)
+}
+
+// Serves /sitemap.xml, which is either the full sitemap or an index of the
+// sitemap pages if there are too many URLs for one sitemap.
+func handleSitemap(w http.ResponseWriter, r *http.Request) {
+	urls, err := collectSitemapURLs()
+	if err != nil {
+		writeSitemapError(w, err)
+		return
+	}
+
+	numPages := numSitemapPages(len(urls))
+	if numPages == 1 {
+		writeSitemapXML(w, sitemapURLSet{Xmlns: sitemapXmlns, URLs: urls})
+		return
+	}
+
+	index := sitemapIndex{Xmlns: sitemapXmlns}
+	for page := 1; page <= numPages; page++ {
+		loc := site.Current.URL("/sitemaps/" + strconv.Itoa(page) + ".xml")
+		index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: loc})
+	}
+	writeSitemapXML(w, index)
+}
+
+// Serves a page of the sitemap, as listed by the sitemap index.
+func handleSitemapPage(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("file"), ".xml"))
+	if err != nil || page < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	urls, err := collectSitemapURLs()
+	if err != nil {
+		writeSitemapError(w, err)
+		return
+	}
+
+	start := (page - 1) * SitemapMaxURLs
+	if start >= len(urls) {
+		http.NotFound(w, r)
+		return
+	}
+
+	end := min(start+SitemapMaxURLs, len(urls))
+	writeSitemapXML(w, sitemapURLSet{Xmlns: sitemapXmlns, URLs: urls[start:end]})
+}
+
+func handleRobotsTxt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "User-agent: *\n")
+	io.WriteString(w, "Allow: /\n")
+	// draft previews must not be indexed, even if their links leak
+	io.WriteString(w, "Disallow: /*?preview=\n")
+	io.WriteString(w, "Disallow: /*&preview=\n")
+	io.WriteString(w, "\n")
+	io.WriteString(w, "Sitemap: "+site.Current.URL("/sitemap.xml")+"\n")
+}
+
+func writeSitemapXML(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+	err := xml.NewEncoder(w).Encode(data)
+	if err != nil {
+		slog.Error("error writing sitemap", slog.String("cause", err.Error()))
+	}
+}
+
+func writeSitemapError(w http.ResponseWriter, err error) {
+	slog.Error("error collecting sitemap urls", slog.String("cause", err.Error()))
+	w.WriteHeader(500)
+}
+
+// Formats a date in the W3C datetime format used by sitemaps.
+func sitemapDate(date time.Time) string {
+	return date.UTC().Format(time.RFC3339)
+}
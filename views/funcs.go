@@ -5,7 +5,9 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/mecha/mecha.dev/assets"
 	"github.com/mecha/mecha.dev/md"
+	"github.com/mecha/mecha.dev/site"
 )
 
 // The functions available in view templates
@@ -13,6 +15,9 @@ var funcMap = template.FuncMap{
 	"Now": time.Now,
 	"IntRange": intRange,
 	"MdFile": mdFile,
+	"Site": siteConfig,
+	"DevMode": devMode,
+	"Asset": assets.URL,
 }
 
 // Generates integers between start and end, inclusive and exclusive respectively.
@@ -37,3 +42,13 @@ func mdFile(path string) template.HTML {
 	}
 	return doc.Body
 }
+
+// Returns whether the site is served in dev mode, with live reloading.
+func devMode() bool {
+	return DevMode
+}
+
+// Returns the configuration of the site being served.
+func siteConfig() *site.Config {
+	return site.Current
+}
@@ -8,6 +8,9 @@ import (
 )
 
 var TemplateFS fs.FS
+
+// Whether pages are served in dev mode, where they reload when files change.
+var DevMode bool
 var cache = map[string]*t.Template{}
 
 const baseTmplFilepath = "base.gotmpl"
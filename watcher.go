@@ -1,16 +1,27 @@
 package main
 
 import (
+	"io/fs"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// How long a watcher waits for a file to settle before reporting its change.
+// Editors often write, rename and chmod a file several times for one save.
+const DefaultDebounce = 100 * time.Millisecond
+
 type DirWatcher struct {
 	dirpath   string
 	callback  EventCallback
 	stopChan  chan bool
 	recursive bool
+	// The time to wait after the last event for a path before calling back
+	debounce time.Duration
 }
 
 type EventCallback func(event fsnotify.Event)
@@ -18,10 +29,20 @@ type EventCallback func(event fsnotify.Event)
 // Creates a new watcher for a directory, that calls the given callback with
 // file system events.
 func NewDirWatcher(path string, cb EventCallback) *DirWatcher {
-	return &DirWatcher{path, cb, nil, false}
+	return &DirWatcher{path, cb, nil, false, DefaultDebounce}
+}
+
+// Creates a new watcher for a directory and its subdirectories, that calls the
+// given callback with file system events. Subdirectories that are created
+// later are also watched.
+func NewRecursiveDirWatcher(path string, cb EventCallback) *DirWatcher {
+	return &DirWatcher{path, cb, nil, true, DefaultDebounce}
 }
 
-// Starts listening for file system events.
+// Starts listening for file system events. The events for a path are coalesced
+// into one event once the path has settled, which is a Remove if the path no
+// longer exists, or otherwise a Write that also has Create if it was created.
+// Events for the temporary files of editors are ignored.
 func (dw *DirWatcher) Start() error {
 	fsw, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -30,6 +51,25 @@ func (dw *DirWatcher) Start() error {
 
 	dw.stopChan = make(chan bool)
 
+	// the ops of the events for each path that has not settled yet
+	pending := map[string]fsnotify.Op{}
+	timers := map[string]*time.Timer{}
+	settled := make(chan string)
+	done := make(chan struct{})
+
+	addPending := func(name string, op fsnotify.Op) {
+		pending[name] |= op
+		if timer, exists := timers[name]; exists {
+			timer.Stop()
+		}
+		timers[name] = time.AfterFunc(dw.debounce, func() {
+			select {
+			case settled <- name:
+			case <-done:
+			}
+		})
+	}
+
 	go func() {
 	loop:
 		for {
@@ -38,7 +78,31 @@ func (dw *DirWatcher) Start() error {
 				if !ok {
 					break loop
 				}
-				dw.callback(event)
+				if isTempFile(event.Name) || event.Op == fsnotify.Chmod {
+					continue
+				}
+
+				if dw.recursive && event.Has(fsnotify.Create) {
+					// the files in a directory that is moved in have no events
+					files, err := addDirs(fsw, event.Name)
+					if err != nil {
+						slog.Error("watcher: failed to watch new directory", slog.String("dir", event.Name), slog.String("cause", err.Error()))
+					}
+					for _, file := range files {
+						addPending(file, fsnotify.Create)
+					}
+				}
+
+				addPending(event.Name, event.Op)
+
+			case name := <-settled:
+				op, isPending := pending[name]
+				if !isPending {
+					continue
+				}
+				delete(pending, name)
+				delete(timers, name)
+				dw.callback(settledEvent(name, op))
 
 			case err, ok := <-fsw.Errors:
 				if !ok {
@@ -51,17 +115,73 @@ func (dw *DirWatcher) Start() error {
 			}
 		}
 
+		close(done)
+		for _, timer := range timers {
+			timer.Stop()
+		}
 		fsw.Close()
 		close(dw.stopChan)
 		dw.stopChan = nil
 	}()
 
-	err = fsw.Add(dw.dirpath)
-	if err != nil {
-		return err
+	if !dw.recursive {
+		return fsw.Add(dw.dirpath)
+	}
+	_, err = addDirs(fsw, dw.dirpath)
+	return err
+}
+
+// Watches a directory and its subdirectories, if the path is a directory.
+// Returns the files inside them.
+func addDirs(fsw *fsnotify.Watcher, dirpath string) ([]string, error) {
+	info, err := os.Stat(dirpath)
+	if err != nil || !info.IsDir() {
+		return nil, nil
 	}
 
-	return nil
+	files := []string{}
+	err = filepath.WalkDir(dirpath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			slog.Debug("watcher: watching directory", "dir", path)
+			return fsw.Add(path)
+		}
+		if !isTempFile(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Creates the event that is reported for a path once its events have settled.
+func settledEvent(name string, op fsnotify.Op) fsnotify.Event {
+	if _, err := os.Lstat(name); err != nil {
+		return fsnotify.Event{Name: name, Op: fsnotify.Remove}
+	}
+	return fsnotify.Event{Name: name, Op: fsnotify.Write | (op & fsnotify.Create)}
+}
+
+// Checks whether a file is a temporary file of an editor, such as a backup, a
+// swap file or the file that is renamed over the original on save. Temporary
+// files with other names are gone by the time that they settle, so they are
+// reported as removed.
+func isTempFile(path string) bool {
+	name := filepath.Base(path)
+	switch {
+	case strings.HasSuffix(name, "~"), // backups of vim, emacs and others
+		strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"),     // emacs auto-saves
+		strings.HasPrefix(name, "."),                                     // hidden files, such as the temporary files of safe writes
+		strings.HasSuffix(name, ".swp"), strings.HasSuffix(name, ".swx"), // vim swap files
+		name == "4913", // vim's check for whether it can write to a directory
+		strings.HasSuffix(name, ".tmp"),
+		strings.Contains(name, "___jb_"): // jetbrains safe writes
+		return true
+	default:
+		return false
+	}
 }
 
 // Stops listening for file system events.